@@ -0,0 +1,186 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/proglottis/tvgame/game"
+)
+
+type adminPlayer struct {
+	ID    string
+	Name  string
+	Score int
+	Away  bool `json:",omitempty"`
+}
+
+type adminAnswer struct {
+	Text    string
+	Correct bool   `json:",omitempty"`
+	Player  string `json:",omitempty"`
+	Votes   int
+}
+
+type adminQuestion struct {
+	Text     string
+	Kind     string `json:",omitempty"`
+	Final    bool   `json:",omitempty"`
+	Round    int
+	Rounds   int
+	Deadline time.Time `json:",omitempty"`
+	Answers  []adminAnswer
+}
+
+// adminRoom describes a room for the admin API.
+type adminRoom struct {
+	Code       string
+	Phase      game.Phase
+	Created    time.Time
+	AgeSeconds int
+	Closed     bool `json:",omitempty"`
+	Draining   bool `json:",omitempty"`
+	Players    []adminPlayer
+	Audience   []adminPlayer  `json:",omitempty"`
+	Question   *adminQuestion `json:",omitempty"`
+}
+
+// Info describes the room, including the current question and its answers
+// if question is set.
+func (r *Room) Info(question bool) *adminRoom {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	info := &adminRoom{
+		Code:       r.Code,
+		Phase:      r.game.Phase(),
+		Created:    r.created,
+		AgeSeconds: int(time.Since(r.created) / time.Second),
+		Closed:     r.closed,
+		Draining:   r.draining,
+		Players:    []adminPlayer{},
+	}
+	for p, score := range r.game.Players {
+		player := p.(*RoomPlayer)
+		info.Players = append(info.Players, adminPlayer{
+			ID:    player.ID,
+			Name:  player.Name,
+			Score: score,
+			Away:  r.game.IsAway(p),
+		})
+	}
+	sort.Slice(info.Players, func(i, j int) bool { return info.Players[i].Name < info.Players[j].Name })
+	for a := range r.game.Audience {
+		audience := a.(*RoomPlayer)
+		info.Audience = append(info.Audience, adminPlayer{ID: audience.ID, Name: audience.Name})
+	}
+	sort.Slice(info.Audience, func(i, j int) bool { return info.Audience[i].Name < info.Audience[j].Name })
+	switch info.Phase {
+	case game.PhaseLobby, game.PhaseComplete:
+		return info
+	}
+	if !question {
+		return info
+	}
+	q := r.game.Current()
+	info.Question = &adminQuestion{
+		Text:     q.Text,
+		Kind:     q.Kind,
+		Final:    q.Final,
+		Round:    indexOf(r.game.Questions, q) + 1,
+		Rounds:   len(r.game.Questions),
+		Deadline: r.game.Deadline(),
+		Answers:  []adminAnswer{},
+	}
+	for _, answer := range q.Answers {
+		a := adminAnswer{
+			Text:    answer.Text,
+			Correct: answer.Correct,
+			Votes:   len(answer.Votes),
+		}
+		if answer.Player != nil {
+			a.Player = answer.Player.(*RoomPlayer).Name
+		}
+		info.Question.Answers = append(info.Question.Answers, a)
+	}
+	return info
+}
+
+func indexOf(questions []*game.Question, q *game.Question) int {
+	for i, question := range questions {
+		if question == q {
+			return i
+		}
+	}
+	return -1
+}
+
+// AdminHandler serves the admin API, allowing only requests bearing token.
+func (s *Server) AdminHandler(token string) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /admin/rooms", func(w http.ResponseWriter, r *http.Request) {
+		rooms := []*adminRoom{}
+		for _, room := range s.allRooms() {
+			rooms = append(rooms, room.Info(false))
+		}
+		sort.Slice(rooms, func(i, j int) bool { return rooms[i].Created.Before(rooms[j].Created) })
+		writeJSON(w, rooms)
+	})
+	mux.HandleFunc("GET /admin/rooms/{code}", s.withRoom(func(w http.ResponseWriter, r *http.Request, room *Room) {
+		writeJSON(w, room.Info(true))
+	}))
+	mux.HandleFunc("POST /admin/rooms/{code}/stop", s.withRoom(func(w http.ResponseWriter, r *http.Request, room *Room) {
+		room.Stop()
+		writeJSON(w, room.Info(true))
+	}))
+	mux.HandleFunc("POST /admin/rooms/{code}/next", s.withRoom(func(w http.ResponseWriter, r *http.Request, room *Room) {
+		room.Next()
+		writeJSON(w, room.Info(true))
+	}))
+	mux.HandleFunc("POST /admin/rooms/{code}/kick/{player}", s.withRoom(func(w http.ResponseWriter, r *http.Request, room *Room) {
+		ban := r.URL.Query().Get("ban") == "true"
+		if err := room.Kick(r.PathValue("player"), ban); err != nil {
+			status := http.StatusBadRequest
+			if errors.Is(err, ErrNoPlayer) {
+				status = http.StatusNotFound
+			}
+			http.Error(w, err.Error(), status)
+			return
+		}
+		writeJSON(w, room.Info(false))
+	}))
+	mux.HandleFunc("DELETE /admin/rooms/{code}", s.withRoom(func(w http.ResponseWriter, r *http.Request, room *Room) {
+		room.Close()
+		s.detachRoom(room.Code)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		given, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+// withRoom finds the room named in the request path for fn.
+func (s *Server) withRoom(fn func(http.ResponseWriter, *http.Request, *Room)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		room, ok := s.room(game.CleanText(r.PathValue("code")))
+		if !ok {
+			http.Error(w, ErrNoRoom.Error(), http.StatusNotFound)
+			return
+		}
+		fn(w, r, room)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestServer_AdminHandler(t *testing.T) {
+	httpServer, serverURL, server := newTestServerWithServer(t)
+	defer httpServer.Close()
+	admin := httptest.NewServer(server.AdminHandler("secret"))
+	defer admin.Close()
+	do := func(method, path, token string) *http.Response {
+		req, err := http.NewRequest(method, admin.URL+path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	host := dial(t, serverURL)
+	defer host.Close()
+	sendMessage(t, host, `{"Type":"create"}`)
+	code := readMessage(t, host, "create").GetPath("Data", "Code").MustString()
+	player := dial(t, serverURL)
+	defer player.Close()
+	sendMessage(t, player, fmt.Sprintf(`{"Type":"join","Data":{"Code":"%s","Name":"bob"}}`, code))
+	playerToken := readMessage(t, player, "ok").GetPath("Data", "Token").MustString()
+	readMessage(t, host, "joined")
+
+	if resp := do("GET", "/admin/rooms", "wrong"); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Expected unauthorized, got %s", resp.Status)
+	}
+	resp := do("GET", "/admin/rooms", "secret")
+	var rooms []adminRoom
+	if err := json.NewDecoder(resp.Body).Decode(&rooms); err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if len(rooms) != 1 || rooms[0].Code != code || len(rooms[0].Players) != 1 {
+		t.Fatalf("Expected room %s with one player, got %+v", code, rooms)
+	}
+
+	sendMessage(t, host, `{"Type":"begin"}`)
+	readMessage(t, host, "question")
+	readMessage(t, player, "answer")
+	resp = do("POST", "/admin/rooms/"+code+"/stop", "secret")
+	var room adminRoom
+	if err := json.NewDecoder(resp.Body).Decode(&room); err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if room.Phase.String() != "vote" || room.Question == nil {
+		t.Errorf("Expected the vote phase with a question, got %+v", room)
+	}
+
+	id := rooms[0].Players[0].ID
+	if resp := do("POST", "/admin/rooms/"+code+"/kick/"+id, "secret"); resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected kick, got %s", resp.Status)
+	}
+	readMessage(t, player, "vote")
+	readMessage(t, player, "kicked")
+	rejoin := dial(t, serverURL)
+	defer rejoin.Close()
+	sendMessage(t, rejoin, fmt.Sprintf(`{"Type":"rejoin","Data":{"Code":"%s","Token":"%s"}}`, code, playerToken))
+	readMessage(t, rejoin, "error")
+
+	if resp := do("DELETE", "/admin/rooms/"+code, "secret"); resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("Expected room closed, got %s", resp.Status)
+	}
+	if resp := do("GET", "/admin/rooms/"+code, "secret"); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected room gone, got %s", resp.Status)
+	}
+}
@@ -0,0 +1,319 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TLS modes.
+const (
+	TLSOff      = "off"
+	TLSAutocert = "autocert"
+	TLSStatic   = "static"
+)
+
+// Config is the server configuration. It is read from an optional JSON file,
+// then environment variables, then flags, each overriding the last.
+type Config struct {
+	// Listen is the address to serve plain HTTP on.
+	Listen string
+	TLS    TLSConfig
+	// PublicURL is where players are told to join, by default the address the
+	// host screen was loaded from.
+	PublicURL string `json:",omitempty"`
+	// Packs are the pack files and directories to load questions from.
+	Packs       []string
+	DBPath      string
+	SnapshotDir string
+	// MaxRooms is the most rooms open at once, zero allows any number.
+	MaxRooms int
+	// HostGraceSeconds is how long a room survives without a host connection.
+	HostGraceSeconds int
+	// DrainSeconds is how long games are given to reach the end of a round
+	// when the server is shutting down.
+	DrainSeconds int
+	// WatchSeconds is how often packs are checked for changes and rooms are
+	// snapshotted.
+	WatchSeconds int
+	// LogLevel is one of debug, info, warn or error.
+	LogLevel string
+	// LogFormat is text or json.
+	LogFormat string
+	// WordList is the file of words rooms filter from names and lies, by
+	// default a short built in list.
+	WordList string `json:",omitempty"`
+	// AdminToken is the bearer token for the admin API, which is disabled
+	// while it is empty.
+	AdminToken string `json:",omitempty"`
+}
+
+type TLSConfig struct {
+	// Mode is one of off, autocert or static.
+	Mode   string
+	Listen string
+	// Domains are the hosts autocert may request certificates for.
+	Domains  []string `json:",omitempty"`
+	CacheDir string   `json:",omitempty"`
+	CertFile string   `json:",omitempty"`
+	KeyFile  string   `json:",omitempty"`
+}
+
+func DefaultConfig() *Config {
+	return &Config{
+		Listen: ":8080",
+		TLS: TLSConfig{
+			Mode:     TLSOff,
+			Listen:   ":8081",
+			CacheDir: "cache",
+		},
+		DBPath:           "tvgame.db",
+		SnapshotDir:      "snapshots",
+		HostGraceSeconds: 120,
+		DrainSeconds:     60,
+		WatchSeconds:     5,
+		LogLevel:         "info",
+		LogFormat:        "text",
+	}
+}
+
+func (c *Config) HostGrace() time.Duration {
+	return time.Duration(c.HostGraceSeconds) * time.Second
+}
+
+func (c *Config) DrainTimeout() time.Duration {
+	return time.Duration(c.DrainSeconds) * time.Second
+}
+
+func (c *Config) WatchInterval() time.Duration {
+	return time.Duration(c.WatchSeconds) * time.Second
+}
+
+// Validate reports the first problem with the configuration.
+func (c *Config) Validate() error {
+	if c.Listen == "" {
+		return fmt.Errorf("Listen must be set")
+	}
+	switch c.TLS.Mode {
+	case TLSOff:
+	case TLSAutocert:
+		if len(c.TLS.Domains) < 1 {
+			return fmt.Errorf("TLS.Domains must be set for autocert")
+		}
+		if c.TLS.CacheDir == "" {
+			return fmt.Errorf("TLS.CacheDir must be set for autocert")
+		}
+	case TLSStatic:
+		if c.TLS.CertFile == "" || c.TLS.KeyFile == "" {
+			return fmt.Errorf("TLS.CertFile and TLS.KeyFile must be set for static TLS")
+		}
+	default:
+		return fmt.Errorf("TLS.Mode must be one of %s, %s or %s, got %q", TLSOff, TLSAutocert, TLSStatic, c.TLS.Mode)
+	}
+	if c.TLS.Mode != TLSOff && c.TLS.Listen == "" {
+		return fmt.Errorf("TLS.Listen must be set")
+	}
+	if c.PublicURL != "" {
+		u, err := url.Parse(c.PublicURL)
+		if err != nil || u.Host == "" {
+			return fmt.Errorf("PublicURL must be an absolute URL, got %q", c.PublicURL)
+		}
+	}
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(c.LogLevel)); err != nil {
+		return fmt.Errorf("LogLevel must be one of debug, info, warn or error, got %q", c.LogLevel)
+	}
+	if c.LogFormat != "text" && c.LogFormat != "json" {
+		return fmt.Errorf("LogFormat must be text or json, got %q", c.LogFormat)
+	}
+	if c.DBPath == "" {
+		return fmt.Errorf("DBPath must be set")
+	}
+	if c.SnapshotDir == "" {
+		return fmt.Errorf("SnapshotDir must be set")
+	}
+	for _, check := range []struct {
+		Name     string
+		V        int
+		Min, Max int
+	}{
+		{"MaxRooms", c.MaxRooms, 0, 100000},
+		{"HostGraceSeconds", c.HostGraceSeconds, 1, 3600},
+		{"DrainSeconds", c.DrainSeconds, 0, 3600},
+		{"WatchSeconds", c.WatchSeconds, 1, 3600},
+	} {
+		if check.V < check.Min || check.V > check.Max {
+			return fmt.Errorf("%s must be between %d and %d, got %d", check.Name, check.Min, check.Max, check.V)
+		}
+	}
+	return nil
+}
+
+// Logger returns a logger writing to w at the configured level and format.
+func (c *Config) Logger(w io.Writer) *slog.Logger {
+	var level slog.Level
+	level.UnmarshalText([]byte(c.LogLevel))
+	opts := &slog.HandlerOptions{Level: level}
+	if c.LogFormat == "json" {
+		return slog.New(slog.NewJSONHandler(w, opts))
+	}
+	return slog.New(slog.NewTextHandler(w, opts))
+}
+
+// Dump writes the configuration as JSON, in the form read from a config
+// file. Secrets are redacted.
+func (c *Config) Dump(w io.Writer) error {
+	dump := *c
+	if dump.AdminToken != "" {
+		dump.AdminToken = "REDACTED"
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(&dump)
+}
+
+// load reads the JSON config file at path over c.
+func (c *Config) load(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	dec := json.NewDecoder(f)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(c); err != nil {
+		return fmt.Errorf("%s: %s", path, err)
+	}
+	return nil
+}
+
+// env reads the environment variables set by getenv over c. PORT and
+// PORT_TLS name only a port, as they did before there was a config file.
+// Lists are comma separated, as with the flags.
+func (c *Config) env(getenv func(string) string) error {
+	for _, v := range []struct {
+		Name string
+		Set  func(string) error
+	}{
+		{"PORT", func(s string) error { c.Listen = ":" + s; return nil }},
+		{"PORT_TLS", func(s string) error { c.TLS.Listen = ":" + s; return nil }},
+		{"TLS_MODE", func(s string) error { c.TLS.Mode = s; return nil }},
+		{"TLS_DOMAINS", listValue{&c.TLS.Domains}.Set},
+		{"TLS_CACHE_DIR", func(s string) error { c.TLS.CacheDir = s; return nil }},
+		{"TLS_CERT_FILE", func(s string) error { c.TLS.CertFile = s; return nil }},
+		{"TLS_KEY_FILE", func(s string) error { c.TLS.KeyFile = s; return nil }},
+		{"PUBLIC_URL", func(s string) error { c.PublicURL = s; return nil }},
+		{"DB_PATH", func(s string) error { c.DBPath = s; return nil }},
+		{"SNAPSHOT_DIR", func(s string) error { c.SnapshotDir = s; return nil }},
+		{"PACKS", listValue{&c.Packs}.Set},
+		{"LOG_LEVEL", func(s string) error { c.LogLevel = s; return nil }},
+		{"LOG_FORMAT", func(s string) error { c.LogFormat = s; return nil }},
+		{"WORD_LIST", func(s string) error { c.WordList = s; return nil }},
+		{"ADMIN_TOKEN", func(s string) error { c.AdminToken = s; return nil }},
+		{"MAX_ROOMS", func(s string) (err error) { c.MaxRooms, err = strconv.Atoi(s); return }},
+		{"HOST_GRACE_SECONDS", func(s string) (err error) { c.HostGraceSeconds, err = strconv.Atoi(s); return }},
+		{"DRAIN_SECONDS", func(s string) (err error) { c.DrainSeconds, err = strconv.Atoi(s); return }},
+		{"WATCH_SECONDS", func(s string) (err error) { c.WatchSeconds, err = strconv.Atoi(s); return }},
+	} {
+		if s := getenv(v.Name); s != "" {
+			if err := v.Set(s); err != nil {
+				return fmt.Errorf("%s: %s", v.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// listValue is a comma separated flag.
+type listValue struct {
+	list *[]string
+}
+
+func (v listValue) String() string {
+	if v.list == nil {
+		return ""
+	}
+	return strings.Join(*v.list, ",")
+}
+
+func (v listValue) Set(s string) error {
+	*v.list = nil
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			*v.list = append(*v.list, item)
+		}
+	}
+	return nil
+}
+
+// flags defines a flag for each setting on fs, defaulting to the current
+// value in c.
+func (c *Config) flags(fs *flag.FlagSet) {
+	fs.StringVar(&c.Listen, "listen", c.Listen, "HTTP listen `address`")
+	fs.StringVar(&c.TLS.Mode, "tls", c.TLS.Mode, "TLS `mode`: off, autocert or static")
+	fs.StringVar(&c.TLS.Listen, "tls-listen", c.TLS.Listen, "HTTPS listen `address`")
+	fs.Var(listValue{&c.TLS.Domains}, "tls-domains", "comma separated `domains` autocert may request certificates for")
+	fs.StringVar(&c.TLS.CacheDir, "tls-cache", c.TLS.CacheDir, "autocert certificate cache `directory`")
+	fs.StringVar(&c.TLS.CertFile, "tls-cert", c.TLS.CertFile, "static TLS certificate `file`")
+	fs.StringVar(&c.TLS.KeyFile, "tls-key", c.TLS.KeyFile, "static TLS key `file`")
+	fs.StringVar(&c.PublicURL, "public-url", c.PublicURL, "`URL` players are told to join at")
+	fs.Var(listValue{&c.Packs}, "packs", "comma separated pack files and `directories`")
+	fs.StringVar(&c.DBPath, "db", c.DBPath, "game history database `file`")
+	fs.StringVar(&c.SnapshotDir, "snapshots", c.SnapshotDir, "room snapshot `directory`")
+	fs.IntVar(&c.MaxRooms, "max-rooms", c.MaxRooms, "most rooms open at once, 0 for no limit")
+	fs.IntVar(&c.HostGraceSeconds, "host-grace", c.HostGraceSeconds, "`seconds` a room survives without its host")
+	fs.IntVar(&c.DrainSeconds, "drain", c.DrainSeconds, "`seconds` games are given to finish a round on shutdown")
+	fs.IntVar(&c.WatchSeconds, "watch", c.WatchSeconds, "`seconds` between checking packs and snapshotting rooms")
+	fs.StringVar(&c.LogLevel, "log-level", c.LogLevel, "log `level`: debug, info, warn or error")
+	fs.StringVar(&c.LogFormat, "log-format", c.LogFormat, "log `format`: text or json")
+	fs.StringVar(&c.WordList, "word-list", c.WordList, "word list `file` to moderate names and lies with, empty for the built in list")
+	fs.StringVar(&c.AdminToken, "admin-token", c.AdminToken, "bearer `token` for the admin API, empty to disable it")
+}
+
+// ParseConfig builds the configuration from the defaults, the config file,
+// the environment and the command line args, in that order. Positional args
+// are pack files and directories, added to those configured. It also
+// reports whether the effective config should be dumped rather than served.
+func ParseConfig(name string, args []string, getenv func(string) string) (*Config, bool, error) {
+	// The first pass only finds the config file, the second applies the
+	// flags over the file and the environment.
+	var path string
+	var dump bool
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	fs.StringVar(&path, "config", getenv("CONFIG"), "")
+	fs.BoolVar(&dump, "dump-config", false, "")
+	DefaultConfig().flags(fs)
+	if err := fs.Parse(args); err != nil && err != flag.ErrHelp {
+		return nil, false, err
+	}
+
+	c := DefaultConfig()
+	if path != "" {
+		if err := c.load(path); err != nil {
+			return nil, false, err
+		}
+	}
+	if err := c.env(getenv); err != nil {
+		return nil, false, err
+	}
+	fs = flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.String("config", path, "JSON config `file`")
+	fs.Bool("dump-config", false, "print the effective config and exit")
+	c.flags(fs)
+	if err := fs.Parse(args); err != nil {
+		return nil, false, err
+	}
+	c.Packs = append(c.Packs, fs.Args()...)
+	if err := c.Validate(); err != nil {
+		return nil, false, err
+	}
+	return c, dump, nil
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(`{"Listen":":9000","MaxRooms":10,"TLS":{"Mode":"autocert","Domains":["example.com"]}}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	env := map[string]string{"MAX_ROOMS": "20", "DB_PATH": "env.db"}
+	getenv := func(name string) string { return env[name] }
+
+	config, dump, err := ParseConfig("tvgame", []string{"-config", path, "-db", "flag.db", "-dump-config", "quiz.csv"}, getenv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !dump {
+		t.Errorf("Expected dump")
+	}
+	if config.Listen != ":9000" {
+		t.Errorf("Expected listen from file, got %q", config.Listen)
+	}
+	if config.TLS.Listen != ":8081" {
+		t.Errorf("Expected default TLS listen, got %q", config.TLS.Listen)
+	}
+	if config.MaxRooms != 20 {
+		t.Errorf("Expected max rooms from env, got %d", config.MaxRooms)
+	}
+	if config.DBPath != "flag.db" {
+		t.Errorf("Expected DB path from flag, got %q", config.DBPath)
+	}
+	if len(config.Packs) != 1 || config.Packs[0] != "quiz.csv" {
+		t.Errorf("Expected packs from args, got %v", config.Packs)
+	}
+
+	// Every setting can be made from the environment alone.
+	env = map[string]string{
+		"TLS_MODE":           TLSStatic,
+		"TLS_CERT_FILE":      "cert.pem",
+		"TLS_KEY_FILE":       "key.pem",
+		"TLS_DOMAINS":        "example.com, www.example.com",
+		"TLS_CACHE_DIR":      "certs",
+		"PACKS":              "packs,extra.csv",
+		"HOST_GRACE_SECONDS": "30",
+		"DRAIN_SECONDS":      "10",
+		"WATCH_SECONDS":      "2",
+	}
+	config, _, err = ParseConfig("tvgame", []string{"-drain", "20"}, getenv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.TLS.CertFile != "cert.pem" || config.TLS.KeyFile != "key.pem" || config.TLS.CacheDir != "certs" {
+		t.Errorf("Expected TLS files from env, got %+v", config.TLS)
+	}
+	if len(config.TLS.Domains) != 2 || config.TLS.Domains[1] != "www.example.com" {
+		t.Errorf("Expected domains from env, got %v", config.TLS.Domains)
+	}
+	if len(config.Packs) != 2 || config.Packs[0] != "packs" {
+		t.Errorf("Expected packs from env, got %v", config.Packs)
+	}
+	if config.HostGraceSeconds != 30 || config.WatchSeconds != 2 {
+		t.Errorf("Expected timeouts from env, got %d and %d", config.HostGraceSeconds, config.WatchSeconds)
+	}
+	if config.DrainSeconds != 20 {
+		t.Errorf("Expected drain from flag over env, got %d", config.DrainSeconds)
+	}
+
+	env["WATCH_SECONDS"] = "soon"
+	if _, _, err := ParseConfig("tvgame", nil, getenv); err == nil {
+		t.Errorf("Expected error for a bad number")
+	}
+}
+
+func TestConfig_Validate(t *testing.T) {
+	for name, modify := range map[string]func(c *Config){
+		"no listen":        func(c *Config) { c.Listen = "" },
+		"unknown TLS mode": func(c *Config) { c.TLS.Mode = "on" },
+		"no domains":       func(c *Config) { c.TLS.Mode = TLSAutocert },
+		"no cert":          func(c *Config) { c.TLS.Mode = TLSStatic; c.TLS.KeyFile = "key.pem" },
+		"relative URL":     func(c *Config) { c.PublicURL = "/join" },
+		"no watch":         func(c *Config) { c.WatchSeconds = 0 },
+		"bad log level":    func(c *Config) { c.LogLevel = "loud" },
+		"bad log format":   func(c *Config) { c.LogFormat = "xml" },
+	} {
+		c := DefaultConfig()
+		modify(c)
+		if err := c.Validate(); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+	if err := DefaultConfig().Validate(); err != nil {
+		t.Errorf("Expected default config to be valid, got %s", err)
+	}
+}
@@ -3,7 +3,9 @@ package main
 import (
 	"context"
 	"encoding/json"
-	"log"
+	"errors"
+	"log/slog"
+	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/websocket"
@@ -21,8 +23,14 @@ const (
 
 	// Maximum message size allowed from peer.
 	maxMessageSize = 512
+
+	// Maximum size of the first message from peer, which may be a create
+	// naming question packs and rules.
+	maxFirstMessageSize = 16 * 1024
 )
 
+var ErrConnClosed = errors.New("Connection closed")
+
 type ConnMessage struct {
 	Type string
 	Data json.RawMessage `json:",omitempty"`
@@ -30,24 +38,43 @@ type ConnMessage struct {
 }
 
 type Conn struct {
+	// ID identifies the connection in logs.
+	ID string
+
 	ws     *websocket.Conn
 	send   chan ConnMessage
+	done   <-chan struct{}
 	cancel context.CancelFunc
+	log    atomic.Pointer[slog.Logger]
 }
 
 func NewConn(ctx context.Context, ws *websocket.Conn) *Conn {
 	conn := &Conn{
+		ID:   generateToken()[:8],
 		ws:   ws,
 		send: make(chan ConnMessage, 500),
 	}
+	conn.log.Store(slog.Default().With("conn", conn.ID))
 	ctx, conn.cancel = context.WithCancel(ctx)
-	conn.ws.SetReadLimit(maxMessageSize)
+	conn.done = ctx.Done()
+	conn.ws.SetReadLimit(maxFirstMessageSize)
 	conn.ws.SetReadDeadline(time.Now().Add(pongWait))
 	conn.ws.SetPongHandler(func(string) error { ws.SetReadDeadline(time.Now().Add(pongWait)); return nil })
 	go conn.writePump(ctx)
 	return conn
 }
 
+// Log returns the logger for the connection, carrying the attributes of
+// whoever is using it.
+func (c *Conn) Log() *slog.Logger {
+	return c.log.Load()
+}
+
+// With adds attributes to every later log line for the connection.
+func (c *Conn) With(args ...any) {
+	c.log.Store(c.Log().With(args...))
+}
+
 func (c *Conn) Close() error {
 	c.cancel()
 	return nil
@@ -57,12 +84,22 @@ func (c *Conn) Read(msg *ConnMessage) error {
 	if err := c.ws.ReadJSON(msg); err != nil {
 		return err
 	}
+	c.ws.SetReadLimit(maxMessageSize)
+	countRead(msg.Type)
+	c.Log().Debug("Read message", "type", msg.Type)
 	return nil
 }
 
 func (c *Conn) Write(msg *ConnMessage) error {
-	c.send <- *msg
-	return nil
+	sendQueueHistogram.Observe(float64(len(c.send)))
+	select {
+	case c.send <- *msg:
+		countWrite(msg.Type)
+		c.Log().Debug("Write message", "type", msg.Type)
+		return nil
+	case <-c.done:
+		return ErrConnClosed
+	}
 }
 
 func (c *Conn) writePump(ctx context.Context) {
@@ -71,6 +108,7 @@ func (c *Conn) writePump(ctx context.Context) {
 		ticker.Stop()
 		c.ws.SetWriteDeadline(time.Now().Add(writeWait))
 		c.ws.WriteMessage(websocket.CloseMessage, []byte{})
+		c.ws.Close()
 	}()
 	for {
 		select {
@@ -80,16 +118,33 @@ func (c *Conn) writePump(ctx context.Context) {
 			}
 			c.ws.SetWriteDeadline(time.Now().Add(writeWait))
 			if err := c.ws.WriteJSON(&message); err != nil {
-				log.Printf("Conn: write: %s", err)
+				c.Log().Warn("Write failed", "type", message.Type, "err", err)
 				return
 			}
 		case <-ticker.C:
 			c.ws.SetWriteDeadline(time.Now().Add(writeWait))
 			if err := c.ws.WriteMessage(websocket.PingMessage, []byte{}); err != nil {
-				log.Printf("Conn: ping: %s", err)
+				c.Log().Warn("Ping failed", "err", err)
 				return
 			}
 		case <-ctx.Done():
+			c.flush()
+			return
+		}
+	}
+}
+
+// flush writes the messages queued before the connection was closed, so
+// that a reason given just before closing, such as for a kick, is sent.
+func (c *Conn) flush() {
+	for {
+		select {
+		case message := <-c.send:
+			c.ws.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := c.ws.WriteJSON(&message); err != nil {
+				return
+			}
+		default:
 			return
 		}
 	}
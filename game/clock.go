@@ -0,0 +1,32 @@
+package game
+
+import (
+	"time"
+)
+
+// Clock is the source of time for phase deadlines. Timer callbacks are
+// invoked from another goroutine, so a Clock used with a Game shared between
+// goroutines must serialise its callbacks with every other call into the
+// Game.
+type Clock interface {
+	Now() time.Time
+	AfterFunc(d time.Duration, f func()) Timer
+}
+
+// Timer is a pending callback created by a Clock.
+type Timer interface {
+	Stop() bool
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (systemClock) AfterFunc(d time.Duration, f func()) Timer {
+	return time.AfterFunc(d, f)
+}
+
+// SystemClock is a Clock backed by the time package.
+var SystemClock Clock = systemClock{}
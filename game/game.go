@@ -3,44 +3,58 @@ package game
 import (
 	"encoding/csv"
 	"errors"
+	"fmt"
 	"io"
 	"math/rand"
 	"sort"
+	"strings"
+	"time"
 	"unicode/utf8"
 )
 
-const (
-	creatorPoints = 1000
-	correctPoints = 1500
-	maxPlayers    = 8
-)
-
 var (
 	ErrCompleted   = errors.New("Already completed")
 	ErrNoAnswer    = errors.New("No such answer")
 	ErrDupAnswer   = errors.New("Answer already exists")
+	ErrTruthAnswer = errors.New("You guessed the truth! Enter a lie instead")
 	ErrOwnAnswer   = errors.New("Choose own answer")
 	ErrShortAnswer = errors.New("Answer is too short")
 	ErrLongAnswer  = errors.New("Answer is too long")
 	ErrRoomFull    = errors.New("Room is full")
+	ErrStarted     = errors.New("Game has already started")
+	ErrAudience    = errors.New("The audience can only vote")
+	ErrNoAudience  = errors.New("Audience is full")
+	ErrLiked       = errors.New("Already liked")
+	ErrNotVoting   = errors.New("Answers can only be liked while voting")
+	ErrSameChoice  = errors.New("Choose a different second answer")
+	ErrNotNumber   = errors.New("Answer must be a number")
+	ErrProfane     = errors.New("Keep it clean! That isn't allowed in this room")
 )
 
 type record struct {
-	Question string
-	Answer   string
+	Question   string
+	Answer     string
+	Alternates []string
+	Category   string
+	Difficulty string
+	Source     string
+	Kind       string
 }
 
 type QuestionRepo struct {
-	records []record
-	answers []string
+	Title       string
+	Description string
+	records     []record
+	answers     []string
 }
 
 func NewQuestionRepo(r io.Reader) (*QuestionRepo, error) {
 	// Format: Question,Answer
-	repo := &QuestionRepo{}
-	answerSet := make(map[string]struct{})
+	// Or, when the first row is a header naming the columns, any of:
+	// Question,Answer,Alternates,Category,Difficulty,Source,Kind
+	var records []record
+	var columns map[string]int
 	csv := csv.NewReader(r)
-	csv.FieldsPerRecord = 2
 	for {
 		row, err := csv.Read()
 		if err == io.EOF {
@@ -49,17 +63,71 @@ func NewQuestionRepo(r io.Reader) (*QuestionRepo, error) {
 		if err != nil {
 			return nil, err
 		}
-		record := record{Question: row[0], Answer: CleanText(row[1])}
-		repo.records = append(repo.records, record)
-		answerSet[record.Answer] = struct{}{}
+		if len(records) == 0 && columns == nil {
+			columns, err = csvHeader(row)
+			if err != nil {
+				return nil, err
+			}
+			if columns != nil {
+				continue
+			}
+			if len(row) != 2 {
+				return nil, fmt.Errorf("Expected 2 fields, got %d", len(row))
+			}
+		}
+		records = append(records, csvRecord(row, columns))
 	}
-	repo.answers = make([]string, 0, len(answerSet))
-	for answer := range answerSet {
-		repo.answers = append(repo.answers, answer)
+	return newQuestionRepo(records)
+}
+
+func newQuestionRepo(records []record) (*QuestionRepo, error) {
+	repo := &QuestionRepo{records: records}
+	for i := range repo.records {
+		record := &repo.records[i]
+		record.Question = strings.TrimSpace(record.Question)
+		record.Answer = CleanText(record.Answer)
+		if record.Question == "" || record.Answer == "" {
+			return nil, fmt.Errorf("Question %d: question and answer are required", i+1)
+		}
+		for j, alternate := range record.Alternates {
+			record.Alternates[j] = CleanText(alternate)
+		}
+		record.Kind = strings.ToLower(strings.TrimSpace(record.Kind))
+		switch record.Kind {
+		case "", KindLie:
+			record.Kind = KindLie
+		case KindNumber:
+			if _, err := ParseNumber(record.Answer); err != nil {
+				return nil, fmt.Errorf("Question %d: %s", i+1, err)
+			}
+		default:
+			return nil, fmt.Errorf("Question %d: unknown kind: %s", i+1, record.Kind)
+		}
 	}
+	repo.indexAnswers()
 	return repo, nil
 }
 
+// indexAnswers collects the distinct answers of every record that could pass
+// as a lie.
+func (r *QuestionRepo) indexAnswers() {
+	answerSet := make(map[string]struct{})
+	for _, record := range r.records {
+		if record.Kind == KindLie {
+			answerSet[record.Answer] = struct{}{}
+		}
+	}
+	r.answers = make([]string, 0, len(answerSet))
+	for answer := range answerSet {
+		r.answers = append(r.answers, answer)
+	}
+}
+
+// Len returns the number of questions in the repo.
+func (r *QuestionRepo) Len() int {
+	return len(r.records)
+}
+
 func sample(n, population int) map[int]struct{} {
 	s := map[int]struct{}{}
 	for len(s) < n && len(s) < population {
@@ -68,15 +136,48 @@ func sample(n, population int) map[int]struct{} {
 	return s
 }
 
-func (r *QuestionRepo) Questions(questions []*Question) []*Question {
-	set := sample(cap(questions)-len(questions), len(r.records))
-	for i := range set {
-		record := r.records[i]
-		questions = append(questions, &Question{
-			Text:       record.Question,
-			Multiplier: 1,
-			Answers:    []*Answer{{Text: record.Answer, Correct: true}},
-		})
+// History records the questions already played, so that later games can
+// avoid repeating them.
+type History map[string]struct{}
+
+func (h History) Add(questions ...*Question) {
+	for _, question := range questions {
+		h[CleanText(question.Text)] = struct{}{}
+	}
+}
+
+func (h History) Has(text string) bool {
+	_, ok := h[CleanText(text)]
+	return ok
+}
+
+// Questions fills questions up to its capacity with randomly chosen questions,
+// preferring those not in used. Questions from used are only drawn once every
+// other question has been.
+func (r *QuestionRepo) Questions(questions []*Question, used History) []*Question {
+	var fresh, stale []int
+	for i, record := range r.records {
+		if used.Has(record.Question) {
+			stale = append(stale, i)
+		} else {
+			fresh = append(fresh, i)
+		}
+	}
+	for _, indexes := range [][]int{fresh, stale} {
+		set := sample(cap(questions)-len(questions), len(indexes))
+		for i := range set {
+			record := r.records[indexes[i]]
+			questions = append(questions, &Question{
+				Text:       record.Question,
+				Category:   record.Category,
+				Difficulty: record.Difficulty,
+				Source:     record.Source,
+				Kind:       record.Kind,
+				Alternates: record.Alternates,
+				Multiplier: 1,
+				Answers:    []*Answer{{Text: record.Answer, Correct: true}},
+			})
+		}
 	}
 	return questions
 }
@@ -91,16 +192,21 @@ func (r *QuestionRepo) Answers(answers []*Answer) []*Answer {
 
 type Host interface {
 	Joined(player Player)
-	Question(question *Question)
-	Vote(question *Question)
+	Left(player Player, complete bool)
+	Question(question *Question, deadline time.Time)
+	Vote(question *Question, deadline time.Time)
 	Collected(player Player, complete bool)
 	Results(game *Game, results ResultSet)
 	Complete(game *Game)
 }
 
 type Player interface {
-	RequestAnswer(question string)
-	RequestVote(question string, answers []string)
+	RequestAnswer(question string, deadline time.Time)
+	RequestVote(question string, answers []string, deadline time.Time)
+	// RequestFinalVote asks for a first and second choice in the final
+	// round. If the player has already made their first choice, first is
+	// that answer and only the second choice is asked for.
+	RequestFinalVote(question string, answers []string, first string, deadline time.Time)
 	Results(game *Game, results ResultSet)
 	Complete(game *Game)
 }
@@ -110,6 +216,13 @@ type Answer struct {
 	Text    string
 	Player  Player
 	Votes   []Player
+	// SecondVotes lists the players who picked the answer as their second
+	// choice in the final round.
+	SecondVotes []Player `json:",omitempty"`
+	// Audience lists the audience members who voted for the answer.
+	Audience []Player `json:",omitempty"`
+	// Likes lists everyone who found the answer funny.
+	Likes []Player `json:",omitempty"`
 }
 
 func (a *Answer) HasVoted(player Player) bool {
@@ -121,6 +234,33 @@ func (a *Answer) HasVoted(player Player) bool {
 	return false
 }
 
+func (a *Answer) HasSecondVote(player Player) bool {
+	for _, vote := range a.SecondVotes {
+		if vote == player {
+			return true
+		}
+	}
+	return false
+}
+
+func (a *Answer) HasAudienceVote(player Player) bool {
+	for _, vote := range a.Audience {
+		if vote == player {
+			return true
+		}
+	}
+	return false
+}
+
+func (a *Answer) HasLiked(player Player) bool {
+	for _, like := range a.Likes {
+		if like == player {
+			return true
+		}
+	}
+	return false
+}
+
 type AnswerSlice []*Answer
 
 func (p AnswerSlice) Len() int           { return len(p) }
@@ -129,8 +269,17 @@ func (p AnswerSlice) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
 
 type Question struct {
 	Text       string
+	Category   string   `json:",omitempty"`
+	Difficulty string   `json:",omitempty"`
+	Source     string   `json:",omitempty"`
+	Kind       string   `json:",omitempty"`
+	Alternates []string `json:",omitempty"`
 	Multiplier int
-	Answers    AnswerSlice
+	// Final marks the final round, where each player picks two answers.
+	Final   bool `json:",omitempty"`
+	Answers AnswerSlice
+	// Guessed lists the players who submitted the truth as their lie.
+	Guessed []Player `json:",omitempty"`
 }
 
 func (q *Question) CorrectAnswer() *Answer {
@@ -145,11 +294,13 @@ func (q *Question) CorrectAnswer() *Answer {
 type Result struct {
 	Player Player
 	Offset int
+	// Audience marks the bonus for the audience favourite.
+	Audience bool `json:",omitempty"`
 }
 
 type ResultSet map[*Answer][]Result
 
-func NewResultSet(q *Question) ResultSet {
+func NewResultSet(q *Question, rules *Rules) ResultSet {
 	r := make(map[*Answer][]Result)
 	for _, answer := range q.Answers {
 		creatorOffset := 0
@@ -157,10 +308,52 @@ func NewResultSet(q *Question) ResultSet {
 			if answer.Correct {
 				r[answer] = append(r[answer], Result{
 					Player: vote,
-					Offset: correctPoints * q.Multiplier,
+					Offset: rules.CorrectPoints * q.Multiplier,
+				})
+			}
+			creatorOffset += rules.CreatorPoints
+		}
+		if creatorOffset > 0 && answer.Player != nil {
+			r[answer] = append(r[answer], Result{
+				Player: answer.Player,
+				Offset: creatorOffset * q.Multiplier,
+			})
+		}
+		if answer.Correct && rules.TruthPoints > 0 {
+			for _, player := range q.Guessed {
+				r[answer] = append(r[answer], Result{
+					Player: player,
+					Offset: rules.TruthPoints * q.Multiplier,
+				})
+			}
+		}
+	}
+	if rules.AudiencePoints > 0 {
+		for _, answer := range q.AudienceFavourites() {
+			r[answer] = append(r[answer], Result{
+				Player:   answer.Player,
+				Offset:   rules.AudiencePoints * q.Multiplier,
+				Audience: true,
+			})
+		}
+	}
+	return r
+}
+
+// NewFinalResultSet scores the final round. First choices are scored as
+// usual, second choices score the second choice points.
+func NewFinalResultSet(q *Question, rules *Rules) ResultSet {
+	r := NewResultSet(q, rules)
+	for _, answer := range q.Answers {
+		creatorOffset := 0
+		for _, vote := range answer.SecondVotes {
+			if answer.Correct {
+				r[answer] = append(r[answer], Result{
+					Player: vote,
+					Offset: rules.SecondCorrectPoints * q.Multiplier,
 				})
 			}
-			creatorOffset += creatorPoints
+			creatorOffset += rules.SecondCreatorPoints
 		}
 		if creatorOffset > 0 && answer.Player != nil {
 			r[answer] = append(r[answer], Result{
@@ -172,6 +365,24 @@ func NewResultSet(q *Question) ResultSet {
 	return r
 }
 
+// AudienceFavourites returns the lies with the most audience votes, more
+// than one if they are tied.
+func (q *Question) AudienceFavourites() []*Answer {
+	var favourites []*Answer
+	most := 1
+	for _, answer := range q.Answers {
+		if answer.Correct || answer.Player == nil || len(answer.Audience) < most {
+			continue
+		}
+		if len(answer.Audience) > most {
+			favourites = nil
+			most = len(answer.Audience)
+		}
+		favourites = append(favourites, answer)
+	}
+	return favourites
+}
+
 type NonCollector struct {
 }
 
@@ -183,45 +394,87 @@ func (c NonCollector) Complete() bool {
 	return true
 }
 
+func (c NonCollector) Add(player Player)    {}
+func (c NonCollector) Remove(player Player) {}
+
 type AnswerCollector struct {
 	Question  *Question
 	Remaining int
+	// Rules limits the length of answers, if nil the default rules are used.
+	Rules *Rules
 }
 
 func (c *AnswerCollector) Collect(player Player, text string) error {
 	if c.Complete() {
 		return ErrCompleted
 	}
-	var answer *Answer
+	rules := c.Rules
+	if rules == nil {
+		rules = DefaultRules()
+	}
 	text = CleanText(text)
-	if utf8.RuneCountInString(text) < 1 {
+	if utf8.RuneCountInString(text) < rules.MinAnswerLength {
 		return ErrShortAnswer
 	}
-	if utf8.RuneCountInString(text) > 50 {
+	if utf8.RuneCountInString(text) > rules.MaxAnswerLength {
 		return ErrLongAnswer
 	}
+	if c.answered(player) {
+		return ErrCompleted
+	}
+	if c.Question.IsTruth(text) {
+		c.guessed(player)
+		return ErrTruthAnswer
+	}
 	for _, a := range c.Question.Answers {
-		if a.Player == player {
-			answer = a
-		}
 		if a.Text == text {
 			return ErrDupAnswer
 		}
 	}
-	if answer != nil {
-		return ErrCompleted
-	}
-	answer = &Answer{Text: text, Player: player}
+	answer := &Answer{Text: text, Player: player}
 	c.Question.Answers = append(c.Question.Answers, answer)
 	sort.Sort(c.Question.Answers)
 	c.Remaining--
 	return nil
 }
 
+// guessed records that player found the truth.
+func (c *AnswerCollector) guessed(player Player) {
+	for _, p := range c.Question.Guessed {
+		if p == player {
+			return
+		}
+	}
+	c.Question.Guessed = append(c.Question.Guessed, player)
+}
+
 func (c *AnswerCollector) Complete() bool {
 	return c.Remaining <= 0
 }
 
+func (c *AnswerCollector) answered(player Player) bool {
+	for _, a := range c.Question.Answers {
+		if a.Player == player {
+			return true
+		}
+	}
+	return false
+}
+
+// Add expects an answer from a player who has returned.
+func (c *AnswerCollector) Add(player Player) {
+	if !c.answered(player) {
+		c.Remaining++
+	}
+}
+
+// Remove stops waiting on an answer from a player who has gone away.
+func (c *AnswerCollector) Remove(player Player) {
+	if !c.answered(player) {
+		c.Remaining--
+	}
+}
+
 type VoteCollector struct {
 	Question  *Question
 	Remaining int
@@ -251,45 +504,227 @@ func (c *VoteCollector) Collect(player Player, text string) error {
 	return nil
 }
 
+// CollectAudience records a vote from an audience member. Audience votes are
+// tallied separately and are not counted towards Remaining.
+func (c *VoteCollector) CollectAudience(player Player, text string) error {
+	var answer *Answer
+	for _, a := range c.Question.Answers {
+		if a.Text == CleanText(text) {
+			answer = a
+		}
+		if a.HasAudienceVote(player) {
+			return ErrCompleted
+		}
+	}
+	if answer == nil {
+		return ErrNoAnswer
+	}
+	answer.Audience = append(answer.Audience, player)
+	return nil
+}
+
+// Like records that player liked the answer text. Any number of answers may
+// be liked, but not the player's own and not the same one twice. Likes do not
+// count as votes.
+func (c *VoteCollector) Like(player Player, text string) error {
+	var answer *Answer
+	for _, a := range c.Question.Answers {
+		if a.Text == CleanText(text) {
+			answer = a
+		}
+	}
+	if answer == nil {
+		return ErrNoAnswer
+	}
+	if answer.Player == player {
+		return ErrOwnAnswer
+	}
+	if answer.HasLiked(player) {
+		return ErrLiked
+	}
+	answer.Likes = append(answer.Likes, player)
+	return nil
+}
+
 func (c *VoteCollector) Complete() bool {
 	return c.Remaining <= 0
 }
 
+func (c *VoteCollector) voted(player Player) bool {
+	for _, a := range c.Question.Answers {
+		if a.HasVoted(player) {
+			return true
+		}
+	}
+	return false
+}
+
+// Add expects a vote from a player who has returned.
+func (c *VoteCollector) Add(player Player) {
+	if !c.voted(player) {
+		c.Remaining++
+	}
+}
+
+// Remove stops waiting on a vote from a player who has gone away.
+func (c *VoteCollector) Remove(player Player) {
+	if !c.voted(player) {
+		c.Remaining--
+	}
+}
+
+// FinalVoteCollector collects a first and then a second choice from each
+// player in the final round. The audience still only vote once.
+type FinalVoteCollector struct {
+	VoteCollector
+}
+
+func (c *FinalVoteCollector) Collect(player Player, text string) error {
+	if c.Complete() {
+		return ErrCompleted
+	}
+	var answer, first *Answer
+	for _, a := range c.Question.Answers {
+		if a.Text == CleanText(text) {
+			answer = a
+		}
+		if a.HasVoted(player) {
+			first = a
+		}
+		if a.HasSecondVote(player) {
+			return ErrCompleted
+		}
+	}
+	if answer == nil {
+		return ErrNoAnswer
+	}
+	if answer.Player == player {
+		return ErrOwnAnswer
+	}
+	if first == nil {
+		answer.Votes = append(answer.Votes, player)
+		return nil
+	}
+	if first == answer {
+		return ErrSameChoice
+	}
+	answer.SecondVotes = append(answer.SecondVotes, player)
+	c.Remaining--
+	return nil
+}
+
+// voted reports whether player has made both choices.
+func (c *FinalVoteCollector) voted(player Player) bool {
+	for _, a := range c.Question.Answers {
+		if a.HasSecondVote(player) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *FinalVoteCollector) Add(player Player) {
+	if !c.voted(player) {
+		c.Remaining++
+	}
+}
+
+func (c *FinalVoteCollector) Remove(player Player) {
+	if !c.voted(player) {
+		c.Remaining--
+	}
+}
+
 type Collector interface {
 	Collect(player Player, text string) error
 	Complete() bool
+	// Add and Remove adjust the collector as players return or go away
+	// part way through a phase.
+	Add(player Player)
+	Remove(player Player)
+}
+
+type Phase int
+
+const (
+	PhaseLobby Phase = iota
+	PhaseAnswer
+	PhaseVote
+	PhaseResults
+	PhaseComplete
+)
+
+var phaseNames = []string{"lobby", "answer", "vote", "results", "complete"}
+
+func (p Phase) String() string {
+	if p < 0 || int(p) >= len(phaseNames) {
+		return "unknown"
+	}
+	return phaseNames[p]
+}
+
+func (p Phase) MarshalText() ([]byte, error) {
+	return []byte(p.String()), nil
 }
 
 type Game struct {
 	Host      Host
+	Rules     *Rules
 	Questions []*Question
+	Rounds    []Round // played on each of the questions in turn
 	Players   map[Player]int
+	// Audience are watching the game and may vote, but do not score.
+	Audience  map[Player]struct{}
+	Clock     Clock
+	OnPhase   func(phase Phase, d time.Duration) // if set, called as each phase ends
+	Moderator Moderator                          // if set, checks names and answers
+	away      map[Player]struct{}
 	current   int
+	step      int
+	phase     Phase
+	started   time.Time
 	collector Collector
+	deadline  time.Time
+	timer     Timer
+	timerSeq  int
+	results   ResultSet
+	scores    []ResultSet
 }
 
-func New(repo *QuestionRepo, host Host) *Game {
+// New creates a game drawing its questions from repo, avoiding those in used
+// where possible. If rules is nil the default rules are used.
+func New(repo *QuestionRepo, host Host, rules *Rules, used History) *Game {
+	if rules == nil {
+		rules = DefaultRules()
+	}
 	game := &Game{
 		Host:      host,
-		Questions: make([]*Question, 0, 7),
+		Rules:     rules,
+		Questions: make([]*Question, 0, rules.Rounds),
 		Players:   make(map[Player]int),
+		Audience:  make(map[Player]struct{}),
+		Clock:     SystemClock,
+		away:      make(map[Player]struct{}),
 		collector: NonCollector{},
 	}
-	game.Questions = repo.Questions(game.Questions)
+	game.Questions = repo.Questions(game.Questions, used)
 	for i, question := range game.Questions {
-		if i < 3 {
-			question.Multiplier = 1
-		} else if i < 6 {
-			question.Multiplier = 2
-		} else {
-			question.Multiplier = 3
-		}
+		question.Multiplier = rules.Multiplier(i)
+	}
+	if last := len(game.Questions) - 1; rules.FinalRound && last > 0 {
+		game.Questions[last].Final = true
+	}
+	for _, question := range game.Questions {
+		game.Rounds = append(game.Rounds, NewRound(question, rules))
 	}
 	return game
 }
 
 func (g *Game) AddPlayer(players ...Player) error {
-	if len(g.Players)+len(players) > maxPlayers {
+	if g.phase != PhaseLobby {
+		return ErrStarted
+	}
+	if len(g.Players)+len(players) > g.Rules.MaxPlayers {
 		return ErrRoomFull
 	}
 	for _, p := range players {
@@ -299,59 +734,305 @@ func (g *Game) AddPlayer(players ...Player) error {
 	return nil
 }
 
-func (g *Game) broadcastQuestion() {
-	question := g.Current()
-	g.Host.Question(question)
-	for player := range g.Players {
-		player.RequestAnswer(question.Text)
+// AddAudience adds audience members to the game. They may join at any time.
+func (g *Game) AddAudience(audience ...Player) error {
+	if len(g.Audience)+len(audience) > g.Rules.MaxAudience {
+		return ErrNoAudience
+	}
+	for _, a := range audience {
+		g.Audience[a] = struct{}{}
 	}
+	return nil
 }
 
-func (g *Game) broadcastVote() {
-	question := g.Current()
-	g.Host.Vote(question)
-	for player := range g.Players {
-		var answers []string
-		for _, answer := range question.Answers {
-			if answer.Player == nil || answer.Player != player {
-				answers = append(answers, answer.Text)
+func (g *Game) RemoveAudience(audience Player) {
+	delete(g.Audience, audience)
+}
+
+func (g *Game) IsAudience(player Player) bool {
+	_, ok := g.Audience[player]
+	return ok
+}
+
+// RemovePlayer removes player from the game altogether, forgetting their
+// score. Whatever they wrote or voted for in the round being played is
+// withdrawn.
+func (g *Game) RemovePlayer(player Player) {
+	if _, ok := g.Players[player]; !ok {
+		return
+	}
+	if _, ok := g.away[player]; !ok {
+		g.collector.Remove(player)
+	}
+	delete(g.Players, player)
+	delete(g.away, player)
+	if g.playing() {
+		g.withdraw(player)
+	}
+	g.Host.Left(player, g.collector.Complete())
+}
+
+// without returns players less player.
+func without(players []Player, player Player) []Player {
+	var kept []Player
+	for _, p := range players {
+		if p != player {
+			kept = append(kept, p)
+		}
+	}
+	return kept
+}
+
+// withdraw takes the answers and votes of a removed player out of the
+// current question. If voting has begun, anyone who voted for a withdrawn
+// answer loses all their votes in the round and is asked to vote again.
+func (g *Game) withdraw(player Player) {
+	round := g.round()
+	question := round.Question()
+	question.Guessed = without(question.Guessed, player)
+	// done are the players the collector counts as finished, only they are
+	// added back when they lose their votes.
+	done := make(map[Player]bool)
+	for p := range g.Players {
+		done[p] = !round.Pending(p, g.phase)
+	}
+	lost := make(map[Player]struct{})
+	withdrawn := false
+	var answers []*Answer
+	for _, answer := range question.Answers {
+		if answer.Player == player {
+			withdrawn = true
+			for _, voters := range [][]Player{answer.Votes, answer.SecondVotes, answer.Audience} {
+				for _, voter := range voters {
+					lost[voter] = struct{}{}
+				}
 			}
+			continue
+		}
+		answer.Votes = without(answer.Votes, player)
+		answer.SecondVotes = without(answer.SecondVotes, player)
+		answer.Likes = without(answer.Likes, player)
+		answers = append(answers, answer)
+	}
+	question.Answers = answers
+	if !withdrawn || g.phase == PhaseAnswer {
+		return
+	}
+	for voter := range lost {
+		for _, answer := range question.Answers {
+			answer.Votes = without(answer.Votes, voter)
+			answer.SecondVotes = without(answer.SecondVotes, voter)
+			answer.Audience = without(answer.Audience, voter)
+		}
+		if _, ok := g.Players[voter]; ok && !g.IsAway(voter) && done[voter] {
+			g.collector.Add(voter)
+		}
+	}
+	// Everyone still to vote is prompted again, so that nobody picks the
+	// withdrawn answer.
+	round.Announce(g.Host, g.phase, g.deadline)
+	for p := range g.Players {
+		if !g.IsAway(p) && round.Pending(p, g.phase) {
+			round.Prompt(p, g.phase, g.deadline)
 		}
-		player.RequestVote(question.Text, answers)
 	}
+	for audience := range g.Audience {
+		if round.Pending(audience, g.phase) {
+			round.PromptAudience(audience, g.phase, g.deadline)
+		}
+	}
+}
+
+// MarkAway excludes player from the current phase and future rounds until
+// they return with MarkBack. Their score is kept.
+func (g *Game) MarkAway(player Player) {
+	if _, ok := g.Players[player]; !ok {
+		return
+	}
+	if _, ok := g.away[player]; ok {
+		return
+	}
+	g.away[player] = struct{}{}
+	g.collector.Remove(player)
+	g.Host.Left(player, g.collector.Complete())
+}
+
+// MarkBack includes a player previously marked away in the game again.
+func (g *Game) MarkBack(player Player) {
+	if _, ok := g.away[player]; !ok {
+		return
+	}
+	delete(g.away, player)
+	g.collector.Add(player)
+	g.Host.Joined(player)
+}
+
+// IsAway reports whether player has been marked away.
+func (g *Game) IsAway(player Player) bool {
+	_, ok := g.away[player]
+	return ok
+}
+
+// present returns the number of players who are not away.
+func (g *Game) present() int {
+	return len(g.Players) - len(g.away)
 }
 
 func (g *Game) broadcastResults(results ResultSet) {
 	g.Host.Results(g, results)
 	for player := range g.Players {
-		player.Results(g, results)
+		if !g.IsAway(player) {
+			player.Results(g, results)
+		}
+	}
+	for audience := range g.Audience {
+		audience.Results(g, results)
 	}
 }
 
 func (g *Game) complete() {
+	g.setPhase(PhaseComplete)
 	g.Host.Complete(g)
 	for player := range g.Players {
-		player.Complete(g)
+		if !g.IsAway(player) {
+			player.Complete(g)
+		}
+	}
+	for audience := range g.Audience {
+		audience.Complete(g)
 	}
 }
 
+// startTimer sets the deadline for the current phase, closing the phase with
+// Stop once it passes.
+func (g *Game) startTimer(d time.Duration) {
+	g.stopTimer()
+	g.deadline = g.Clock.Now().Add(d)
+	seq := g.timerSeq
+	g.timer = g.Clock.AfterFunc(d, func() {
+		// The phase may have been closed while this callback was waiting to
+		// run, in which case it belongs to a stale deadline.
+		if seq != g.timerSeq {
+			return
+		}
+		g.Stop()
+	})
+}
+
+func (g *Game) stopTimer() {
+	g.timerSeq++
+	if g.timer != nil {
+		g.timer.Stop()
+		g.timer = nil
+	}
+	g.deadline = time.Time{}
+}
+
+// round returns the round being played.
+func (g *Game) round() Round {
+	return g.Rounds[g.current]
+}
+
+// enter begins the phase at step in the current round.
+func (g *Game) enter(step int) {
+	round := g.round()
+	g.step = step
+	g.setPhase(round.Phases()[step])
+	g.collector = round.Collector(g.phase, g.present())
+	g.startTimer(round.Time(g.phase))
+	round.Announce(g.Host, g.phase, g.deadline)
+	for player := range g.Players {
+		if !g.IsAway(player) {
+			round.Prompt(player, g.phase, g.deadline)
+		}
+	}
+	for audience := range g.Audience {
+		round.PromptAudience(audience, g.phase, g.deadline)
+	}
+}
+
+// advance closes the current phase, moving on to the next phase of the round
+// or scoring the round after its last phase.
+func (g *Game) advance() {
+	if g.step+1 < len(g.round().Phases()) {
+		g.enter(g.step + 1)
+		return
+	}
+	g.stopTimer()
+	g.setPhase(PhaseResults)
+	g.collector = NonCollector{}
+	g.results = g.round().Score()
+	g.scores = append(g.scores, g.results)
+	for _, points := range g.results {
+		for _, offset := range points {
+			g.Players[offset.Player] += offset.Offset
+		}
+	}
+	g.broadcastResults(g.results)
+}
+
+// setPhase moves the game into phase, reporting how long the last phase
+// lasted. Time spent in the lobby, or in the phase a game was restored in, is
+// not reported.
+func (g *Game) setPhase(phase Phase) {
+	now := g.Clock.Now()
+	if g.OnPhase != nil && !g.started.IsZero() {
+		g.OnPhase(g.phase, now.Sub(g.started))
+	}
+	g.phase = phase
+	g.started = now
+}
+
+// playing reports whether a round is in one of its own phases.
+func (g *Game) playing() bool {
+	switch g.phase {
+	case PhaseLobby, PhaseResults, PhaseComplete:
+		return false
+	}
+	return true
+}
+
+// Phase returns the phase the game is currently in.
+func (g *Game) Phase() Phase {
+	return g.phase
+}
+
+// Deadline returns when the current phase closes, or the zero time if the
+// current phase has no deadline.
+func (g *Game) Deadline() time.Time {
+	return g.deadline
+}
+
 func (g *Game) Begin() {
-	g.collector = &AnswerCollector{
-		Question:  g.Current(),
-		Remaining: len(g.Players),
+	if g.phase != PhaseLobby {
+		return
 	}
-	g.broadcastQuestion()
+	g.enter(0)
 }
 
+// Vote closes the answer phase, once every answer is in or the host moves
+// the game on.
 func (g *Game) Vote() {
-	g.collector = &VoteCollector{
-		Question:  g.Current(),
-		Remaining: len(g.Players),
+	if g.phase != PhaseAnswer {
+		return
 	}
-	g.broadcastVote()
+	g.advance()
 }
 
 func (g *Game) Collect(player Player, text string) error {
+	if g.IsAudience(player) {
+		collector, ok := g.collector.(AudienceCollector)
+		if !ok {
+			return ErrAudience
+		}
+		return collector.CollectAudience(player, text)
+	}
+	// Lies are moderated before anyone sees them, votes choose from those.
+	if g.phase == PhaseAnswer {
+		if err := g.Moderate(text); err != nil {
+			return err
+		}
+	}
 	err := g.collector.Collect(player, text)
 	if err != nil {
 		return err
@@ -360,35 +1041,122 @@ func (g *Game) Collect(player Player, text string) error {
 	return nil
 }
 
+// Moderate checks text written by a player, such as their name, at the
+// strictness set by the rules.
+func (g *Game) Moderate(text string) error {
+	if g.Moderator == nil {
+		return nil
+	}
+	return g.Moderator.Moderate(text, g.Rules.Moderation)
+}
+
+// Like records that player liked the answer text in the current question.
+// Only players may like answers, the audience can only vote.
+func (g *Game) Like(player Player, text string) error {
+	if g.IsAudience(player) {
+		return ErrAudience
+	}
+	collector, ok := g.collector.(LikeCollector)
+	if !ok {
+		return ErrNotVoting
+	}
+	return collector.Like(player, text)
+}
+
+// Likes returns the number of likes each player's lies have received over
+// the game so far.
+func (g *Game) Likes() map[Player]int {
+	likes := make(map[Player]int)
+	for _, question := range g.Questions {
+		for _, answer := range question.Answers {
+			if _, ok := g.Players[answer.Player]; ok {
+				likes[answer.Player] += len(answer.Likes)
+			}
+		}
+	}
+	return likes
+}
+
+// Funniest returns the players whose lies were liked the most, more than one
+// if they are tied. Nobody is funniest if nothing was liked.
+func (g *Game) Funniest() []Player {
+	var funniest []Player
+	most := 1
+	for player, likes := range g.Likes() {
+		if likes < most {
+			continue
+		}
+		if likes > most {
+			funniest = nil
+			most = likes
+		}
+		funniest = append(funniest, player)
+	}
+	return funniest
+}
+
+// Stop closes the current phase of the round, whether or not everyone has
+// taken part.
 func (g *Game) Stop() {
-	switch g.collector.(type) {
-	case *AnswerCollector:
-		g.Vote()
+	if !g.playing() {
+		return
+	}
+	g.advance()
+}
+
+// Results returns the result set of the most recently closed question.
+func (g *Game) Results() ResultSet {
+	return g.results
+}
+
+// Scores returns the result set of each round scored so far, in order.
+func (g *Game) Scores() []ResultSet {
+	return g.scores
+}
+
+// Close stops any pending deadline. The game must not be used afterwards.
+func (g *Game) Close() {
+	g.stopTimer()
+}
+
+// Replay sends player whatever the current phase still needs from them, so
+// that a player returning on a new connection picks up where they left off.
+func (g *Game) Replay(player Player) {
+	audience := g.IsAudience(player)
+	if _, ok := g.Players[player]; !ok && !audience {
+		return
+	}
+	switch g.phase {
+	case PhaseLobby:
+	case PhaseResults:
+		player.Results(g, g.results)
+	case PhaseComplete:
+		player.Complete(g)
 	default:
-		g.collector = NonCollector{}
-		results := NewResultSet(g.Current())
-		for _, points := range results {
-			for _, offset := range points {
-				g.Players[offset.Player] += offset.Offset
-			}
+		round := g.round()
+		if !round.Pending(player, g.phase) {
+			return
+		}
+		if audience {
+			round.PromptAudience(player, g.phase, g.deadline)
+		} else {
+			round.Prompt(player, g.phase, g.deadline)
 		}
-		g.broadcastResults(results)
 	}
 }
 
 func (g *Game) Current() *Question {
-	return g.Questions[g.current]
+	return g.round().Question()
 }
 
 func (g *Game) Next() {
+	if g.phase != PhaseResults {
+		return
+	}
 	g.current++
-	if g.current >= len(g.Questions) {
+	if g.current >= len(g.Rounds) {
 		g.complete()
 		return
 	}
-	g.collector = &AnswerCollector{
-		Question:  g.Current(),
-		Remaining: len(g.Players),
-	}
-	g.broadcastQuestion()
+	g.enter(0)
 }
@@ -2,8 +2,11 @@ package game
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
+	"strings"
 	"testing"
+	"time"
 )
 
 const (
@@ -19,25 +22,107 @@ L?,Lemon
 M?,Mango
 O?,Orange`
 	questionFileLines = 10
+	headerFile        = `Question,Answer,Alternates,Category,Difficulty
+Longest river?,The Nile,Nile|River Nile,Geography,easy
+Largest ocean?,Pacific,,Geography,medium`
+	jsonFile = `{
+  "title": "Geography",
+  "questions": [
+    {"question": "Longest river?", "answer": "The Nile", "alternates": ["Nile"], "category": "Rivers", "source": "Atlas"}
+  ]
+}`
+	numberFile = `Question,Answer,Kind
+Year of the moon landing?,1969,number
+Longest river?,The Nile,`
 )
 
 type testPlayer struct {
 	Name string
 }
 
-func (testPlayer) RequestAnswer(question string)                 {}
-func (testPlayer) RequestVote(question string, answers []string) {}
-func (testPlayer) Results(game *Game, results ResultSet)         {}
-func (testPlayer) Complete(game *Game)                           {}
+func (testPlayer) RequestAnswer(question string, deadline time.Time)                 {}
+func (testPlayer) RequestVote(question string, answers []string, deadline time.Time) {}
+func (testPlayer) RequestFinalVote(question string, answers []string, first string, deadline time.Time) {
+}
+func (testPlayer) Results(game *Game, results ResultSet) {}
+func (testPlayer) Complete(game *Game)                   {}
+
+// promptPlayer records the prompts it receives.
+type promptPlayer struct {
+	testPlayer
+	Prompts []string
+	// First is the first choice given with the last final prompt.
+	First string
+}
+
+func (p *promptPlayer) RequestAnswer(question string, deadline time.Time) {
+	p.Prompts = append(p.Prompts, "answer")
+}
+
+func (p *promptPlayer) RequestVote(question string, answers []string, deadline time.Time) {
+	p.Prompts = append(p.Prompts, "vote")
+}
+
+func (p *promptPlayer) RequestFinalVote(question string, answers []string, first string, deadline time.Time) {
+	p.Prompts = append(p.Prompts, "final")
+	p.First = first
+}
+
+func (p *promptPlayer) Results(game *Game, results ResultSet) {
+	p.Prompts = append(p.Prompts, "results")
+}
+
+func (p *promptPlayer) Complete(game *Game) {
+	p.Prompts = append(p.Prompts, "complete")
+}
 
 type testHost struct{}
 
-func (testHost) Joined(player Player)                   {}
-func (testHost) Question(question *Question)            {}
-func (testHost) Vote(question *Question)                {}
-func (testHost) Collected(player Player, complete bool) {}
-func (testHost) Results(game *Game, results ResultSet)  {}
-func (testHost) Complete(game *Game)                    {}
+func (testHost) Joined(player Player)                            {}
+func (testHost) Left(player Player, complete bool)               {}
+func (testHost) Question(question *Question, deadline time.Time) {}
+func (testHost) Vote(question *Question, deadline time.Time)     {}
+func (testHost) Collected(player Player, complete bool)          {}
+func (testHost) Results(game *Game, results ResultSet)           {}
+func (testHost) Complete(game *Game)                             {}
+
+type testTimer struct {
+	when    time.Time
+	f       func()
+	stopped bool
+}
+
+func (t *testTimer) Stop() bool {
+	active := !t.stopped
+	t.stopped = true
+	return active
+}
+
+type testClock struct {
+	now    time.Time
+	timers []*testTimer
+}
+
+func (c *testClock) Now() time.Time {
+	return c.now
+}
+
+func (c *testClock) AfterFunc(d time.Duration, f func()) Timer {
+	timer := &testTimer{when: c.now.Add(d), f: f}
+	c.timers = append(c.timers, timer)
+	return timer
+}
+
+// Advance moves the clock forward, running any timers that fall due.
+func (c *testClock) Advance(d time.Duration) {
+	c.now = c.now.Add(d)
+	for _, timer := range c.timers {
+		if !timer.stopped && !timer.when.After(c.now) {
+			timer.stopped = true
+			timer.f()
+		}
+	}
+}
 
 func TestQuestionRepo_bad_format(t *testing.T) {
 	buf := bytes.NewBufferString(badFile)
@@ -47,6 +132,103 @@ func TestQuestionRepo_bad_format(t *testing.T) {
 	}
 }
 
+func TestQuestionRepo_header(t *testing.T) {
+	repo, err := NewQuestionRepo(bytes.NewBufferString(headerFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	questions := repo.Questions(make([]*Question, 0, 2), nil)
+	if len(questions) != 2 {
+		t.Fatalf("Expected 2 questions, got %d", len(questions))
+	}
+	for _, question := range questions {
+		if question.Category != "Geography" {
+			t.Errorf("Expected category Geography, got %q", question.Category)
+		}
+		if question.Text == "Longest river?" {
+			if len(question.Alternates) != 2 || question.Alternates[1] != "RIVER NILE" {
+				t.Errorf("Expected alternates [NILE RIVER NILE], got %q", question.Alternates)
+			}
+			if question.Difficulty != "easy" {
+				t.Errorf("Expected difficulty easy, got %q", question.Difficulty)
+			}
+		}
+	}
+
+	if _, err := NewQuestionRepo(bytes.NewBufferString("Question,Answer,Colour\nA?,Apple,Red")); err == nil {
+		t.Errorf("Expected unknown column error")
+	}
+	if _, err := NewQuestionRepo(bytes.NewBufferString("Question,Category\nA?,Fruit")); err == nil {
+		t.Errorf("Expected missing answer column error")
+	}
+}
+
+func TestQuestionRepo_JSON(t *testing.T) {
+	repo, err := NewQuestionRepoJSON(bytes.NewBufferString(jsonFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if repo.Title != "Geography" {
+		t.Errorf("Expected title Geography, got %q", repo.Title)
+	}
+	questions := repo.Questions(make([]*Question, 0, 1), nil)
+	if len(questions) != 1 {
+		t.Fatalf("Expected 1 question, got %d", len(questions))
+	}
+	question := questions[0]
+	if question.CorrectAnswer().Text != "THE NILE" || question.Source != "Atlas" || question.Category != "Rivers" {
+		t.Errorf("Unexpected question %#v", question)
+	}
+
+	if _, err := NewQuestionRepoJSON(bytes.NewBufferString(`{"questions":[{"question":"A?"}]}`)); err == nil {
+		t.Errorf("Expected missing answer error")
+	}
+}
+
+func TestQuestionRepo_kind(t *testing.T) {
+	repo, err := NewQuestionRepo(bytes.NewBufferString(numberFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	kinds := make(map[string]string)
+	for _, question := range repo.Questions(make([]*Question, 0, 2), nil) {
+		kinds[question.Text] = question.Kind
+	}
+	if kinds["Year of the moon landing?"] != KindNumber || kinds["Longest river?"] != KindLie {
+		t.Errorf("Unexpected kinds %q", kinds)
+	}
+	if len(repo.answers) != 1 {
+		t.Errorf("Expected numbers not to be used as lies, got %q", repo.answers)
+	}
+
+	for _, file := range []string{
+		"Question,Answer,Kind\nA?,Apple,number",
+		"Question,Answer,Kind\nA?,Apple,drawing",
+	} {
+		if _, err := NewQuestionRepo(bytes.NewBufferString(file)); err == nil {
+			t.Errorf("Expected error for %q", file)
+		}
+	}
+}
+
+func TestMergeQuestionRepos(t *testing.T) {
+	fruit := newRepo(t)
+	more, err := NewQuestionRepo(bytes.NewBufferString("A?,Apple\nP?,Pear"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	merged := MergeQuestionRepos(fruit, more)
+	if merged.Len() != questionFileLines+1 {
+		t.Errorf("Expected %d questions, got %d", questionFileLines+1, merged.Len())
+	}
+	if len(merged.answers) != questionFileLines+1 {
+		t.Errorf("Expected %d answers, got %d", questionFileLines+1, len(merged.answers))
+	}
+	if fruit.Len() != questionFileLines || more.Len() != 2 {
+		t.Errorf("Expected merged repos to be unchanged")
+	}
+}
+
 func TestQuestionRepo_Questions(t *testing.T) {
 	repo := newRepo(t)
 	for _, test := range []struct {
@@ -57,13 +239,33 @@ func TestQuestionRepo_Questions(t *testing.T) {
 		{N: questionFileLines, Expected: questionFileLines},
 		{N: questionFileLines + 1, Expected: questionFileLines},
 	} {
-		questions := repo.Questions(make([]*Question, 0, test.N))
+		questions := repo.Questions(make([]*Question, 0, test.N), nil)
 		if len(questions) != test.Expected {
 			t.Errorf("Expected %d questions, got %d", test.Expected, len(questions))
 		}
 	}
 }
 
+func TestQuestionRepo_Questions_used(t *testing.T) {
+	repo := newRepo(t)
+	used := History{}
+	first := repo.Questions(make([]*Question, 0, questionFileLines-3), used)
+	used.Add(first...)
+	second := repo.Questions(make([]*Question, 0, 5), used)
+	if len(second) != 5 {
+		t.Fatalf("Expected 5 questions, got %d", len(second))
+	}
+	fresh := 0
+	for _, question := range second {
+		if !used.Has(question.Text) {
+			fresh++
+		}
+	}
+	if fresh != 3 {
+		t.Errorf("Expected all 3 unused questions to be drawn first, got %d", fresh)
+	}
+}
+
 func TestQuestionRepo_Answers(t *testing.T) {
 	repo := newRepo(t)
 	for _, test := range []struct {
@@ -92,14 +294,14 @@ func TestNewResultSet(t *testing.T) {
 		Answers: []*Answer{a1, a2, a3},
 	}
 
-	results := NewResultSet(question)
+	results := NewResultSet(question, DefaultRules())
 	if len(results) > 0 {
 		t.Errorf("Expected empty result set, got %#v", results)
 	}
 
 	a1.Votes = append(a1.Votes, p1)
 	a2.Votes = append(a2.Votes, p2)
-	results = NewResultSet(question)
+	results = NewResultSet(question, DefaultRules())
 	if results[a1][0].Player != p1 {
 		t.Errorf("Expected p1 to get points for correct answer")
 	}
@@ -137,6 +339,72 @@ func TestAnswerCollector_Collect(t *testing.T) {
 	}
 }
 
+func TestAnswerCollector_Collect_truth(t *testing.T) {
+	p1 := &testPlayer{}
+	question := &Question{
+		Text:       "Longest river?",
+		Multiplier: 1,
+		Alternates: []string{"RIVER NILE"},
+		Answers:    []*Answer{{Text: "NILE", Correct: true}},
+	}
+	collector := AnswerCollector{Question: question, Remaining: 1}
+
+	for _, text := range []string{"nile", "THE NILE", "Nile!", "Rivr Nile", "River Nile"} {
+		if err := collector.Collect(p1, text); err != ErrTruthAnswer {
+			t.Errorf("Expected ErrTruthAnswer for %q, got %s", text, err)
+		}
+	}
+	if len(question.Guessed) != 1 || question.Guessed[0] != p1 {
+		t.Errorf("Expected p1 to have guessed the truth once, got %v", question.Guessed)
+	}
+	if err := collector.Collect(p1, "Amazon"); err != nil {
+		t.Errorf("Expected success, got %s", err)
+	}
+	results := NewResultSet(question, DefaultRules())
+	if correct := results[question.CorrectAnswer()]; len(correct) != 0 {
+		t.Errorf("Expected no points for guessing the truth by default, got %v", correct)
+	}
+	rules := DefaultRules()
+	rules.TruthPoints = 500
+	results = NewResultSet(question, rules)
+	correct := results[question.CorrectAnswer()]
+	if len(correct) != 1 || correct[0].Offset != rules.TruthPoints {
+		t.Errorf("Expected p1 to get %d points for guessing the truth, got %v", rules.TruthPoints, results)
+	}
+}
+
+func TestSimilar(t *testing.T) {
+	for _, test := range []struct {
+		Guess    string
+		Answer   string
+		Expected bool
+	}{
+		{Guess: "The Nile", Answer: "NILE", Expected: true},
+		{Guess: "MILE", Answer: "NILE", Expected: false},
+		{Guess: "Seven", Answer: "7", Expected: true},
+		{Guess: "twenty one", Answer: "21", Expected: true},
+		{Guess: "one hundred and five", Answer: "105", Expected: true},
+		{Guess: "two thousand and one", Answer: "2001", Expected: true},
+		{Guess: "twenty one", Answer: "20", Expected: false},
+		{Guess: "1,000", Answer: "1000", Expected: true},
+		{Guess: "1,000,001", Answer: "1,000,000", Expected: false},
+		{Guess: "Apollo 13", Answer: "APOLLO 11", Expected: false},
+		{Guess: "Apolo 13", Answer: "APOLLO 13", Expected: true},
+		{Guess: "206 bones", Answer: "205 BONES", Expected: false},
+		{Guess: "World War I", Answer: "WORLD WAR II", Expected: false},
+		{Guess: "Henry VII", Answer: "HENRY VIII", Expected: false},
+		{Guess: "Henri VIII", Answer: "HENRY VIII", Expected: true},
+		{Guess: "New-Zealand", Answer: "NEW ZEALAND", Expected: true},
+		{Guess: "Missisippi", Answer: "MISSISSIPPI", Expected: true},
+		{Guess: "A", Answer: "A", Expected: true},
+		{Guess: "Danube", Answer: "AMAZON", Expected: false},
+	} {
+		if got := Similar(test.Guess, test.Answer); got != test.Expected {
+			t.Errorf("Similar(%q, %q) expected %v, got %v", test.Guess, test.Answer, test.Expected, got)
+		}
+	}
+}
+
 func TestAnswerCollector_Complete(t *testing.T) {
 	question := &Question{Text: "Fruit?"}
 	collector := AnswerCollector{Question: question, Remaining: 2}
@@ -185,6 +453,95 @@ func TestVoteCollector_Collect(t *testing.T) {
 	}
 }
 
+func TestVoteCollector_Like(t *testing.T) {
+	p1 := &testPlayer{}
+	p2 := &testPlayer{}
+	question := &Question{
+		Text: "Fruit?",
+		Answers: []*Answer{
+			{Text: "APPLE", Correct: true},
+			{Text: "BANANA", Player: p2},
+			{Text: "CARROT", Player: p1},
+		},
+	}
+	collector := VoteCollector{Question: question, Remaining: 2}
+
+	if err := collector.Like(p1, "Carrot"); err != ErrOwnAnswer {
+		t.Errorf("Expected ErrOwnAnswer, got %s", err)
+	}
+	if err := collector.Like(p1, "Banana"); err != nil {
+		t.Errorf("Expected success, got %s", err)
+	}
+	if err := collector.Like(p1, "Banana"); err != ErrLiked {
+		t.Errorf("Expected ErrLiked, got %s", err)
+	}
+	if err := collector.Like(p1, "Nonexistent"); err != ErrNoAnswer {
+		t.Errorf("Expected ErrNoAnswer, got %s", err)
+	}
+	if err := collector.Like(p2, "Carrot"); err != nil {
+		t.Errorf("Expected success, got %s", err)
+	}
+	if err := collector.Collect(p1, "Banana"); err != nil {
+		t.Errorf("Expected a like not to count as a vote, got %s", err)
+	}
+	if collector.Remaining != 1 {
+		t.Errorf("Expected 1 remaining answer, got %d", collector.Remaining)
+	}
+}
+
+func TestFinalVoteCollector_Collect(t *testing.T) {
+	p1 := &testPlayer{}
+	p2 := &testPlayer{}
+	question := &Question{
+		Text:  "Fruit?",
+		Final: true,
+		Answers: []*Answer{
+			{Text: "APPLE", Correct: true},
+			{Text: "BANANA", Player: p2},
+			{Text: "CARROT", Player: p1},
+		},
+	}
+	collector := FinalVoteCollector{VoteCollector{Question: question, Remaining: 2}}
+
+	if err := collector.Collect(p1, "Carrot"); err != ErrOwnAnswer {
+		t.Errorf("Expected ErrOwnAnswer, got %s", err)
+	}
+	if err := collector.Collect(p1, "Banana"); err != nil {
+		t.Errorf("Expected success, got %s", err)
+	}
+	if collector.Remaining != 2 {
+		t.Errorf("Expected a first choice to leave 2 remaining, got %d", collector.Remaining)
+	}
+	if err := collector.Collect(p1, "Banana"); err != ErrSameChoice {
+		t.Errorf("Expected ErrSameChoice, got %s", err)
+	}
+	if err := collector.Collect(p1, "Apple"); err != nil {
+		t.Errorf("Expected success, got %s", err)
+	}
+	if collector.Remaining != 1 {
+		t.Errorf("Expected 1 remaining, got %d", collector.Remaining)
+	}
+	if err := collector.Collect(p1, "Apple"); err != ErrCompleted {
+		t.Errorf("Expected ErrCompleted, got %s", err)
+	}
+
+	rules := DefaultRules()
+	question.Multiplier = 1
+	results := NewFinalResultSet(question, rules)
+	totals := make(map[Player]int)
+	for _, result := range results {
+		for _, r := range result {
+			totals[r.Player] += r.Offset
+		}
+	}
+	if totals[p1] != rules.SecondCorrectPoints {
+		t.Errorf("Expected p1 to score %d, got %d", rules.SecondCorrectPoints, totals[p1])
+	}
+	if totals[p2] != rules.CreatorPoints {
+		t.Errorf("Expected p2 to score %d, got %d", rules.CreatorPoints, totals[p2])
+	}
+}
+
 func TestVoteCollector_Complete(t *testing.T) {
 	question := &Question{Text: "Fruit?"}
 	collector := VoteCollector{Question: question, Remaining: 2}
@@ -200,7 +557,7 @@ func TestVoteCollector_Complete(t *testing.T) {
 func TestGame_AddPlayer(t *testing.T) {
 	host := &testHost{}
 	repo := newRepo(t)
-	game := New(repo, host)
+	game := New(repo, host, nil, nil)
 	for i := 0; i < maxPlayers; i++ {
 		if err := game.AddPlayer(&testPlayer{Name: fmt.Sprintf("%d", i+1)}); err != nil {
 			t.Fatalf("Expected success, got %s", err)
@@ -211,12 +568,699 @@ func TestGame_AddPlayer(t *testing.T) {
 	}
 }
 
+func TestRules_Validate(t *testing.T) {
+	for _, name := range PresetNames() {
+		rules, err := Preset(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := rules.Validate(); err != nil {
+			t.Errorf("Expected preset %s to be valid, got %s", name, err)
+		}
+	}
+	if _, err := Preset("nonexistent"); err == nil {
+		t.Errorf("Expected unknown preset error")
+	}
+	for _, modify := range []func(r *Rules){
+		func(r *Rules) { r.Rounds = 0 },
+		func(r *Rules) { r.MaxPlayers = maxPlayers + 1 },
+		func(r *Rules) { r.Multipliers = nil },
+		func(r *Rules) { r.Multipliers = []int{1, 0} },
+		func(r *Rules) { r.MaxAnswerLength = r.MinAnswerLength - 1 },
+		func(r *Rules) { r.VoteSeconds = 0 },
+	} {
+		rules := DefaultRules()
+		modify(rules)
+		if err := rules.Validate(); err == nil {
+			t.Errorf("Expected %#v to be invalid", rules)
+		}
+	}
+}
+
+func TestGame_rules(t *testing.T) {
+	rules := DefaultRules()
+	rules.Rounds = 4
+	rules.Multipliers = []int{1, 5}
+	rules.MaxPlayers = 2
+	game := New(newRepo(t), &testHost{}, rules, nil)
+	if len(game.Questions) != 4 {
+		t.Fatalf("Expected 4 questions, got %d", len(game.Questions))
+	}
+	for i, expected := range []int{1, 5, 5, 5} {
+		if game.Questions[i].Multiplier != expected {
+			t.Errorf("Expected question %d multiplier %d, got %d", i, expected, game.Questions[i].Multiplier)
+		}
+	}
+	if err := game.AddPlayer(&testPlayer{}, &testPlayer{}, &testPlayer{}); err != ErrRoomFull {
+		t.Errorf("Expected ErrRoomFull, got %s", err)
+	}
+}
+
+func TestGame_AddPlayer_started(t *testing.T) {
+	game := New(newRepo(t), &testHost{}, nil, nil)
+	game.Clock = &testClock{}
+	game.AddPlayer(&testPlayer{Name: "B1"})
+	game.Begin()
+	if err := game.AddPlayer(&testPlayer{Name: "B2"}); err != ErrStarted {
+		t.Fatalf("Expected ErrStarted, got %s", err)
+	}
+}
+
+func TestGame_Replay(t *testing.T) {
+	p1 := &promptPlayer{}
+	p2 := &promptPlayer{}
+	game := New(newRepo(t), &testHost{}, nil, nil)
+	game.Clock = &testClock{}
+	game.AddPlayer(p1, p2)
+
+	expectReplay := func(player *promptPlayer, expected string) {
+		t.Helper()
+		player.Prompts = nil
+		game.Replay(player)
+		var got string
+		if len(player.Prompts) > 0 {
+			got = player.Prompts[0]
+		}
+		if got != expected {
+			t.Errorf("Expected replay %q, got %q", expected, got)
+		}
+	}
+
+	expectReplay(p1, "")
+	game.Begin()
+	if err := game.Collect(p1, "Moose"); err != nil {
+		t.Fatal(err)
+	}
+	expectReplay(p1, "")
+	expectReplay(p2, "answer")
+	game.Vote()
+	if err := game.Collect(p2, "Moose"); err != nil {
+		t.Fatal(err)
+	}
+	expectReplay(p1, "vote")
+	expectReplay(p2, "")
+	game.Stop()
+	expectReplay(p1, "results")
+	game.current = len(game.Questions) - 1
+	game.Next()
+	expectReplay(p2, "complete")
+	expectReplay(&promptPlayer{}, "")
+}
+
+func TestGame_MarkAway(t *testing.T) {
+	p1 := &promptPlayer{}
+	p2 := &promptPlayer{}
+	p3 := &promptPlayer{}
+	game := New(newRepo(t), &testHost{}, nil, nil)
+	game.Clock = &testClock{}
+	game.AddPlayer(p1, p2, p3)
+
+	game.Begin()
+	if err := game.Collect(p1, "Moose"); err != nil {
+		t.Fatal(err)
+	}
+	game.MarkAway(p1)
+	game.MarkAway(p2)
+	game.MarkAway(p2)
+	if err := game.Collect(p3, "Monkey"); err != nil {
+		t.Fatal(err)
+	}
+	if !game.collector.Complete() {
+		t.Fatal("Expected answers to be complete without away players")
+	}
+
+	game.Vote()
+	if len(p1.Prompts) != 1 || len(p2.Prompts) != 1 {
+		t.Errorf("Expected away players not to be asked to vote")
+	}
+	if remaining := game.collector.(*VoteCollector).Remaining; remaining != 1 {
+		t.Errorf("Expected 1 remaining vote, got %d", remaining)
+	}
+	game.MarkBack(p1)
+	if remaining := game.collector.(*VoteCollector).Remaining; remaining != 2 {
+		t.Errorf("Expected 2 remaining votes, got %d", remaining)
+	}
+
+	game.RemovePlayer(p2)
+	if _, ok := game.Players[p2]; ok {
+		t.Errorf("Expected p2 to be removed")
+	}
+	if game.IsAway(p2) {
+		t.Errorf("Expected removed player not to be away")
+	}
+	if remaining := game.collector.(*VoteCollector).Remaining; remaining != 2 {
+		t.Errorf("Expected 2 remaining votes, got %d", remaining)
+	}
+}
+
+func TestGame_RemovePlayer_withdraw(t *testing.T) {
+	p1 := &promptPlayer{}
+	p2 := &promptPlayer{}
+	p3 := &promptPlayer{}
+	game := New(newRepo(t), &testHost{}, nil, nil)
+	game.Clock = &testClock{}
+	game.AddPlayer(p1, p2, p3)
+
+	game.Begin()
+	for player, lie := range map[Player]string{p1: "Moose", p2: "Monkey", p3: "Mouse"} {
+		if err := game.Collect(player, lie); err != nil {
+			t.Fatal(err)
+		}
+	}
+	game.Vote()
+	if err := game.Collect(p3, "Moose"); err != nil {
+		t.Fatal(err)
+	}
+
+	game.RemovePlayer(p1)
+	for _, answer := range game.Current().Answers {
+		if answer.Text == "Moose" {
+			t.Errorf("Expected the lie of a removed player to be withdrawn")
+		}
+	}
+	if remaining := game.collector.(*VoteCollector).Remaining; remaining != 2 {
+		t.Errorf("Expected 2 remaining votes, got %d", remaining)
+	}
+	if prompts := p3.Prompts; prompts[len(prompts)-1] != "vote" || len(prompts) != 3 {
+		t.Errorf("Expected p3 to be asked to vote again, got %v", prompts)
+	}
+
+	if err := game.Collect(p2, game.Current().CorrectAnswer().Text); err != nil {
+		t.Fatal(err)
+	}
+	if err := game.Collect(p3, "Monkey"); err != nil {
+		t.Fatal(err)
+	}
+	game.Stop()
+	if _, ok := game.Players[p1]; ok {
+		t.Errorf("Expected the removed player not to score")
+	}
+	if score := game.Players[p2]; score != game.Rules.CorrectPoints+game.Rules.CreatorPoints {
+		t.Errorf("Expected p2 to score %d, got %d", game.Rules.CorrectPoints+game.Rules.CreatorPoints, score)
+	}
+}
+
+func TestGame_RemovePlayer_withdraw_final(t *testing.T) {
+	p1 := &promptPlayer{}
+	p2 := &promptPlayer{}
+	p3 := &promptPlayer{}
+	rules := DefaultRules()
+	rules.Rounds = 2
+	game := New(newRepo(t), &testHost{}, rules, nil)
+	game.Clock = &testClock{}
+	game.AddPlayer(p1, p2, p3)
+
+	game.Begin()
+	game.Vote()
+	game.Stop()
+	game.Next()
+	for player, lie := range map[Player]string{p1: "Moose", p2: "Monkey", p3: "Mouse"} {
+		if err := game.Collect(player, lie); err != nil {
+			t.Fatal(err)
+		}
+	}
+	game.Vote()
+	// p3 has only made their first choice when it is withdrawn.
+	if err := game.Collect(p3, "Moose"); err != nil {
+		t.Fatal(err)
+	}
+
+	game.RemovePlayer(p1)
+	collector := game.collector.(*FinalVoteCollector)
+	if collector.Remaining != 2 {
+		t.Errorf("Expected 2 remaining votes, got %d", collector.Remaining)
+	}
+	truth := game.Current().CorrectAnswer().Text
+	for player, choices := range map[Player][]string{p2: {truth, "Mouse"}, p3: {truth, "Monkey"}} {
+		for _, choice := range choices {
+			if err := game.Collect(player, choice); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if !collector.Complete() {
+		t.Errorf("Expected voting to be complete, got %d remaining", collector.Remaining)
+	}
+}
+
+func TestGame_audience(t *testing.T) {
+	p1 := &promptPlayer{}
+	p2 := &promptPlayer{}
+	a1 := &promptPlayer{}
+	a2 := &promptPlayer{}
+	rules := DefaultRules()
+	rules.AudiencePoints = 500
+	game := New(newRepo(t), &testHost{}, rules, nil)
+	game.Clock = &testClock{}
+	game.AddPlayer(p1, p2)
+	if err := game.AddAudience(a1); err != nil {
+		t.Fatal(err)
+	}
+
+	game.Begin()
+	if err := game.AddAudience(a2); err != nil {
+		t.Fatal(err)
+	}
+	if len(a1.Prompts) != 0 {
+		t.Errorf("Expected the audience not to be asked to answer")
+	}
+	if err := game.Collect(a1, "Moose"); err != ErrAudience {
+		t.Errorf("Expected %v, got %v", ErrAudience, err)
+	}
+	game.Collect(p1, "Moose")
+	game.Collect(p2, "Monkey")
+
+	game.Vote()
+	if len(a1.Prompts) != 1 || len(a2.Prompts) != 1 {
+		t.Fatalf("Expected the audience to be asked to vote")
+	}
+	if err := game.Collect(a1, "MOOSE"); err != nil {
+		t.Fatal(err)
+	}
+	if err := game.Collect(a1, "MONKEY"); err != ErrCompleted {
+		t.Errorf("Expected %v, got %v", ErrCompleted, err)
+	}
+	if err := game.Like(a1, "MONKEY"); err != ErrAudience {
+		t.Errorf("Expected %v, got %v", ErrAudience, err)
+	}
+	if err := game.Collect(a2, "MOOSE"); err != nil {
+		t.Fatal(err)
+	}
+	if remaining := game.collector.(*VoteCollector).Remaining; remaining != 2 {
+		t.Errorf("Expected audience votes not to count, got %d remaining", remaining)
+	}
+	game.Stop()
+
+	if _, ok := game.Players[a1]; ok {
+		t.Errorf("Expected the audience not to score")
+	}
+	multiplier := game.Current().Multiplier
+	if got, want := game.Players[p1], game.Rules.AudiencePoints*multiplier; got != want {
+		t.Errorf("Expected audience favourite to score %d, got %d", want, got)
+	}
+	if got := game.Players[p2]; got != 0 {
+		t.Errorf("Expected 0, got %d", got)
+	}
+}
+
+func TestGame_AddAudience_full(t *testing.T) {
+	rules := DefaultRules()
+	rules.MaxAudience = 1
+	game := New(newRepo(t), &testHost{}, rules, nil)
+	if err := game.AddAudience(&testPlayer{Name: "A1"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := game.AddAudience(&testPlayer{Name: "A2"}); err != ErrNoAudience {
+		t.Errorf("Expected %v, got %v", ErrNoAudience, err)
+	}
+}
+
+func TestGame_Funniest(t *testing.T) {
+	p1 := &testPlayer{Name: "B1"}
+	p2 := &testPlayer{Name: "B2"}
+	p3 := &testPlayer{Name: "B3"}
+	game := New(newRepo(t), &testHost{}, nil, nil)
+	game.Clock = &testClock{}
+	game.AddPlayer(p1, p2, p3)
+
+	game.Begin()
+	if err := game.Like(p2, "MOOSE"); err != ErrNotVoting {
+		t.Errorf("Expected %v, got %v", ErrNotVoting, err)
+	}
+	game.Collect(p1, "Moose")
+	game.Collect(p2, "Monkey")
+	game.Collect(p3, "Mouse")
+	game.Vote()
+	if len(game.Funniest()) != 0 {
+		t.Errorf("Expected nobody to be funniest without likes")
+	}
+	for _, like := range []struct {
+		player Player
+		text   string
+	}{
+		{p2, "MOOSE"},
+		{p3, "MOOSE"},
+		{p1, "MONKEY"},
+		{p1, "MOUSE"},
+	} {
+		if err := game.Like(like.player, like.text); err != nil {
+			t.Fatal(err)
+		}
+	}
+	game.Stop()
+
+	if likes := game.Likes(); likes[p1] != 2 || likes[p2] != 1 || likes[p3] != 1 {
+		t.Errorf("Unexpected likes %v", likes)
+	}
+	if funniest := game.Funniest(); len(funniest) != 1 || funniest[0] != p1 {
+		t.Errorf("Expected p1 to be funniest, got %v", funniest)
+	}
+}
+
+func TestGame_final_round(t *testing.T) {
+	p1 := &promptPlayer{}
+	a1 := &promptPlayer{}
+	rules := DefaultRules()
+	rules.Rounds = 2
+	game := New(newRepo(t), &testHost{}, rules, nil)
+	game.Clock = &testClock{}
+	game.AddPlayer(p1)
+	game.AddAudience(a1)
+	if game.Questions[0].Final || !game.Questions[1].Final {
+		t.Fatal("Expected only the last question to be final")
+	}
+
+	game.Begin()
+	game.Vote()
+	if _, ok := game.collector.(*VoteCollector); !ok {
+		t.Errorf("Expected a vote collector, got %T", game.collector)
+	}
+	game.Stop()
+	game.Next()
+	game.Vote()
+	if _, ok := game.collector.(*FinalVoteCollector); !ok {
+		t.Errorf("Expected a final vote collector, got %T", game.collector)
+	}
+	if prompt := p1.Prompts[len(p1.Prompts)-1]; prompt != "final" || p1.First != "" {
+		t.Errorf("Expected a final prompt with no first choice, got %s %q", prompt, p1.First)
+	}
+	if prompt := a1.Prompts[len(a1.Prompts)-1]; prompt != "vote" {
+		t.Errorf("Expected the audience to vote as usual, got %s", prompt)
+	}
+	if err := game.Collect(a1, game.Current().CorrectAnswer().Text); err != nil {
+		t.Errorf("Expected success, got %s", err)
+	}
+
+	// A player returning after their first choice resumes at the second.
+	first := game.Current().CorrectAnswer().Text
+	if err := game.Collect(p1, first); err != nil {
+		t.Fatal(err)
+	}
+	game.Replay(p1)
+	if prompt := p1.Prompts[len(p1.Prompts)-1]; prompt != "final" || p1.First != first {
+		t.Errorf("Expected a final prompt with first choice %q, got %s %q", first, prompt, p1.First)
+	}
+}
+
+// quickRound is a round with only an answer phase, where every answer scores
+// a point.
+type quickRound struct {
+	LieRound
+}
+
+func (r *quickRound) Phases() []Phase {
+	return []Phase{PhaseAnswer}
+}
+
+func (r *quickRound) Score() ResultSet {
+	results := make(ResultSet)
+	for _, answer := range r.question.Answers {
+		if answer.Player != nil {
+			results[answer] = []Result{{Player: answer.Player, Offset: 1}}
+		}
+	}
+	return results
+}
+
+func TestGame_Rounds(t *testing.T) {
+	p1 := &promptPlayer{}
+	game := New(newRepo(t), &testHost{}, nil, nil)
+	game.Clock = &testClock{}
+	game.Rounds[0] = &quickRound{*NewLieRound(game.Questions[0], game.Rules)}
+	game.AddPlayer(p1)
+
+	game.Begin()
+	if err := game.Collect(p1, "Moose"); err != nil {
+		t.Fatal(err)
+	}
+	game.Stop()
+	if phase := game.Phase(); phase != PhaseResults {
+		t.Fatalf("Expected the round to skip voting, got %s", phase)
+	}
+	if game.Players[p1] != 1 {
+		t.Errorf("Expected 1 point, got %d", game.Players[p1])
+	}
+	game.Next()
+	if phase := game.Phase(); phase != PhaseAnswer {
+		t.Fatalf("Expected the next round to begin, got %s", phase)
+	}
+	game.Stop()
+	if phase := game.Phase(); phase != PhaseVote {
+		t.Errorf("Expected the next round to vote, got %s", phase)
+	}
+}
+
+func TestGame_OnPhase(t *testing.T) {
+	clock := &testClock{now: time.Now()}
+	game := New(newRepo(t), &testHost{}, nil, nil)
+	game.Clock = clock
+	game.AddPlayer(&testPlayer{Name: "B1"})
+	durations := make(map[Phase]time.Duration)
+	game.OnPhase = func(phase Phase, d time.Duration) {
+		durations[phase] = d
+	}
+
+	game.Begin()
+	clock.Advance(5 * time.Second)
+	game.Vote()
+	clock.Advance(game.Rules.VoteTime())
+	if len(durations) != 2 {
+		t.Fatalf("Expected the answer and vote phases, got %v", durations)
+	}
+	if durations[PhaseAnswer] != 5*time.Second {
+		t.Errorf("Expected answer phase of 5s, got %v", durations[PhaseAnswer])
+	}
+	if durations[PhaseVote] != game.Rules.VoteTime() {
+		t.Errorf("Expected vote phase of %v, got %v", game.Rules.VoteTime(), durations[PhaseVote])
+	}
+}
+
+func TestParseNumber(t *testing.T) {
+	for text, want := range map[string]float64{
+		"1969":    1969,
+		" 6,650 ": 6650,
+		"-2.5":    -2.5,
+	} {
+		if got, err := ParseNumber(text); err != nil || got != want {
+			t.Errorf("ParseNumber(%q) = %v, %v, want %v", text, got, err, want)
+		}
+	}
+	for _, text := range []string{"", "twelve", "NaN", "Inf"} {
+		if _, err := ParseNumber(text); err != ErrNotNumber {
+			t.Errorf("ParseNumber(%q) expected ErrNotNumber, got %v", text, err)
+		}
+	}
+}
+
+func TestGame_number_round(t *testing.T) {
+	p1 := &testPlayer{Name: "B1"}
+	p2 := &testPlayer{Name: "B2"}
+	p3 := &testPlayer{Name: "B3"}
+	p4 := &testPlayer{Name: "B4"}
+	question := &Question{
+		Text:       "Year of the moon landing?",
+		Kind:       KindNumber,
+		Multiplier: 1,
+		Answers:    []*Answer{{Text: "1969", Correct: true}},
+	}
+	game := New(newRepo(t), &testHost{}, nil, nil)
+	game.Clock = &testClock{}
+	game.Questions[0] = question
+	game.Rounds[0] = NewRound(question, game.Rules)
+	game.AddPlayer(p1, p2, p3, p4)
+
+	game.Begin()
+	if err := game.Collect(p1, "nineteen"); err != ErrNotNumber {
+		t.Errorf("Expected ErrNotNumber, got %v", err)
+	}
+	for player, guess := range map[Player]string{p1: "1969", p2: "1,970", p3: "1968", p4: "2000"} {
+		if err := game.Collect(player, guess); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := game.Collect(p1, "1969"); err != ErrCompleted {
+		t.Errorf("Expected ErrCompleted, got %v", err)
+	}
+	game.Vote()
+	if phase := game.Phase(); phase != PhaseResults {
+		t.Fatalf("Expected results without a vote, got %s", phase)
+	}
+	points := game.Rules.CorrectPoints
+	for player, want := range map[Player]int{p1: points, p2: points * 2 / 3, p3: points * 2 / 3, p4: points / 3} {
+		if got := game.Players[player]; got != want {
+			t.Errorf("Expected %s to score %d, got %d", player.(*testPlayer).Name, want, got)
+		}
+	}
+}
+
+func TestWordList_Moderate(t *testing.T) {
+	list, err := NewWordList(strings.NewReader("# comment\n\nbadword\nrude,strict\n!rudedog\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		Text  string
+		Level Moderation
+		Err   error
+	}{
+		{"badword", ModerationOff, nil},
+		{"badword", ModerationMild, ErrProfane},
+		{"What a BadWord!", ModerationMild, ErrProfane},
+		{"b4dw0rd", ModerationMild, ErrProfane},
+		{"b@dw0rd!", ModerationMild, ErrProfane},
+		{"b a d w o r d", ModerationMild, ErrProfane},
+		{"b.a.d.w.o.r.d", ModerationMild, ErrProfane},
+		{"badwords", ModerationMild, nil},
+		{"badwords", ModerationStrict, ErrProfane},
+		{"bad word", ModerationStrict, nil},
+		{"rude", ModerationMild, nil},
+		{"rude", ModerationStrict, ErrProfane},
+		{"rudest", ModerationStrict, ErrProfane},
+		{"rudedog", ModerationStrict, nil},
+		{"crude", ModerationStrict, nil},
+		{"a good answer", ModerationStrict, nil},
+		{"4 to 1", ModerationStrict, nil},
+	} {
+		if err := list.Moderate(test.Text, test.Level); err != test.Err {
+			t.Errorf("Expected %v for %q at level %d, got %v", test.Err, test.Text, test.Level, err)
+		}
+	}
+	if _, err := NewWordList(strings.NewReader("rude,sometimes\n")); err == nil {
+		t.Error("Expected an error for an unknown level")
+	}
+	if err := DefaultWordList().Moderate("sh1t", ModerationMild); err != ErrProfane {
+		t.Errorf("Expected the default list to reject, got %v", err)
+	}
+	for _, text := range []string{"WAS HIT BY A BUS", "HAS HIT", "PASS EXAM", "THIS EXAMPLE", "ESSEX", "SUSSEX", "SCRAPBOOK", "ARSENAL"} {
+		if err := DefaultWordList().Moderate(text, ModerationStrict); err != nil {
+			t.Errorf("Expected the default list to allow %q, got %v", text, err)
+		}
+	}
+}
+
+func TestGame_Moderate(t *testing.T) {
+	p1 := &testPlayer{Name: "B1"}
+	p2 := &testPlayer{Name: "B2"}
+	list, err := NewWordList(strings.NewReader("badword\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	game := New(newRepo(t), &testHost{}, nil, nil)
+	game.Clock = &testClock{}
+	game.Moderator = list
+	game.AddPlayer(p1, p2)
+
+	if err := game.Moderate("B A D W O R D"); err != ErrProfane {
+		t.Errorf("Expected ErrProfane, got %v", err)
+	}
+	game.Begin()
+	if err := game.Collect(p1, "a badword"); err != ErrProfane {
+		t.Errorf("Expected ErrProfane, got %v", err)
+	}
+	if len(game.Current().Answers) != 1 {
+		t.Errorf("Expected the lie to be rejected, got %d answers", len(game.Current().Answers))
+	}
+	if err := game.Collect(p1, "a fine lie"); err != nil {
+		t.Errorf("Expected success, got %v", err)
+	}
+
+	game.Rules.Moderation = ModerationOff
+	if err := game.Collect(p2, "a badword"); err != nil {
+		t.Errorf("Expected success with moderation off, got %v", err)
+	}
+}
+
+func TestGame_Snapshot(t *testing.T) {
+	p1 := &testPlayer{Name: "B1"}
+	p2 := &testPlayer{Name: "B2"}
+	a1 := &testPlayer{Name: "A1"}
+	game := New(newRepo(t), &testHost{}, nil, nil)
+	game.Clock = &testClock{}
+	game.AddPlayer(p1, p2)
+	game.AddAudience(a1)
+	game.Begin()
+	game.Collect(p1, "Moose")
+	game.Collect(p2, "Monkey")
+	game.Vote()
+	game.Collect(a1, "Monkey")
+	game.Like(p1, "Monkey")
+	// The audience cannot like answers now, but snapshots of games from
+	// before could hold their likes.
+	for _, answer := range game.Current().Answers {
+		if answer.Text == "MONKEY" {
+			answer.Likes = append(answer.Likes, a1)
+		}
+	}
+	game.Collect(p1, game.Current().CorrectAnswer().Text)
+	game.Collect(p2, "Moose")
+	game.Stop()
+	game.Next()
+	game.Collect(p1, "Moose")
+
+	names := map[Player]string{p1: "B1", p2: "B2"}
+	buf, err := json.Marshal(game.Snapshot(func(p Player) string { return names[p] }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var snapshot Snapshot
+	if err := json.Unmarshal(buf, &snapshot); err != nil {
+		t.Fatal(err)
+	}
+	players := map[string]Player{"B1": p1, "B2": p2}
+	restored, err := Restore(&snapshot, &testHost{}, func(id string) Player { return players[id] }, []string{"B2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock := &testClock{}
+	restored.Clock = clock
+	restored.Resume()
+
+	if restored.Phase() != PhaseAnswer || restored.Current().Text != game.Current().Text {
+		t.Fatalf("Expected to resume answering %q, got %s %q", game.Current().Text, restored.Phase(), restored.Current().Text)
+	}
+	if restored.Players[p1] != game.Players[p1] || restored.Players[p1] == 0 {
+		t.Errorf("Expected p1 to keep %d points, got %d", game.Players[p1], restored.Players[p1])
+	}
+	if len(restored.Scores()) != 1 || len(restored.Scores()[0]) != len(game.Scores()[0]) {
+		t.Errorf("Expected the scores of the first round to be restored")
+	}
+	if !restored.IsAway(p2) || restored.IsAway(p1) {
+		t.Errorf("Expected only p2 to be away")
+	}
+	if len(restored.Audience) != 0 {
+		t.Errorf("Expected the audience not to be restored, got %d", len(restored.Audience))
+	}
+	if likes := restored.Likes(); likes[p2] != 1 {
+		t.Errorf("Expected only the like of p1 to be restored, got %v", likes)
+	}
+	if !restored.collector.Complete() {
+		t.Errorf("Expected nothing to be waited on while p2 is away")
+	}
+	restored.MarkBack(p2)
+	if err := restored.Collect(p2, "Monkey"); err != nil {
+		t.Fatal(err)
+	}
+	clock.Advance(restored.Rules.AnswerTime())
+	if restored.Phase() != PhaseVote {
+		t.Errorf("Expected the resumed deadline to move on to voting, got %s", restored.Phase())
+	}
+
+	snapshot.Step = 5
+	if _, err := Restore(&snapshot, &testHost{}, func(id string) Player { return players[id] }, nil); err == nil {
+		t.Errorf("Expected error restoring an unknown step")
+	}
+	if _, err := Restore(&snapshot, &testHost{}, func(id string) Player { return nil }, nil); err == nil {
+		t.Errorf("Expected error restoring unknown players")
+	}
+}
+
 func TestGame_p1_always_wins(t *testing.T) {
 	host := &testHost{}
 	p1 := &testPlayer{Name: "B1"}
 	p2 := &testPlayer{Name: "B2"}
 	repo := newRepo(t)
-	game := New(repo, host)
+	game := New(repo, host, nil, nil)
+	game.Clock = &testClock{}
 	if len(game.Questions) != 7 {
 		t.Fatalf("Expected 7 questions")
 	}
@@ -247,6 +1291,73 @@ func TestGame_p1_always_wins(t *testing.T) {
 	}
 }
 
+func TestGame_deadlines(t *testing.T) {
+	host := &testHost{}
+	p1 := &testPlayer{Name: "B1"}
+	p2 := &testPlayer{Name: "B2"}
+	clock := &testClock{now: time.Date(2016, 3, 1, 12, 0, 0, 0, time.UTC)}
+	game := New(newRepo(t), host, nil, nil)
+	game.Clock = clock
+	game.AddPlayer(p1, p2)
+
+	game.Begin()
+	if expected := clock.now.Add(game.Rules.AnswerTime()); !game.Deadline().Equal(expected) {
+		t.Errorf("Expected answer deadline %s, got %s", expected, game.Deadline())
+	}
+	clock.Advance(game.Rules.AnswerTime() - time.Second)
+	if game.Phase() != PhaseAnswer {
+		t.Fatalf("Expected answer phase, got %s", game.Phase())
+	}
+	if err := game.Collect(p1, "Moose"); err != nil {
+		t.Fatal(err)
+	}
+	clock.Advance(time.Second)
+	if game.Phase() != PhaseVote {
+		t.Fatalf("Expected vote phase, got %s", game.Phase())
+	}
+	if err := game.Collect(p2, "Moose"); err != nil {
+		t.Fatal(err)
+	}
+	clock.Advance(game.Rules.VoteTime())
+	if game.Phase() != PhaseResults {
+		t.Fatalf("Expected results phase, got %s", game.Phase())
+	}
+	if !game.Deadline().IsZero() {
+		t.Errorf("Expected no deadline during results, got %s", game.Deadline())
+	}
+	if game.Players[p1] != game.Rules.CreatorPoints {
+		t.Errorf("p1 expected %d points, got %d", game.Rules.CreatorPoints, game.Players[p1])
+	}
+}
+
+func TestGame_stale_deadline(t *testing.T) {
+	host := &testHost{}
+	p1 := &testPlayer{Name: "B1"}
+	clock := &testClock{}
+	game := New(newRepo(t), host, nil, nil)
+	game.Clock = clock
+	game.AddPlayer(p1)
+
+	game.Begin()
+	clock.Advance(game.Rules.AnswerTime() / 2)
+	game.Stop()
+	game.Stop()
+	game.Next()
+	if game.Phase() != PhaseAnswer {
+		t.Fatalf("Expected answer phase, got %s", game.Phase())
+	}
+	// The first question's deadlines have been replaced and must not close
+	// the second question early.
+	clock.Advance(game.Rules.AnswerTime() / 2)
+	if game.Phase() != PhaseAnswer {
+		t.Errorf("Expected answer phase, got %s", game.Phase())
+	}
+	clock.Advance(game.Rules.AnswerTime() / 2)
+	if game.Phase() != PhaseVote {
+		t.Errorf("Expected vote phase, got %s", game.Phase())
+	}
+}
+
 func newRepo(t testing.TB) *QuestionRepo {
 	buf := bytes.NewBufferString(questionFile)
 	repo, err := NewQuestionRepo(buf)
@@ -0,0 +1,221 @@
+package game
+
+import (
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+var articles = map[string]struct{}{
+	"THE": {},
+	"A":   {},
+	"AN":  {},
+}
+
+var numberWords = map[string]int{
+	"ZERO": 0, "ONE": 1, "TWO": 2, "THREE": 3, "FOUR": 4, "FIVE": 5,
+	"SIX": 6, "SEVEN": 7, "EIGHT": 8, "NINE": 9, "TEN": 10,
+	"ELEVEN": 11, "TWELVE": 12, "THIRTEEN": 13, "FOURTEEN": 14,
+	"FIFTEEN": 15, "SIXTEEN": 16, "SEVENTEEN": 17, "EIGHTEEN": 18,
+	"NINETEEN": 19, "TWENTY": 20, "THIRTY": 30, "FORTY": 40, "FIFTY": 50,
+	"SIXTY": 60, "SEVENTY": 70, "EIGHTY": 80, "NINETY": 90,
+	"HUNDRED": 100, "THOUSAND": 1000,
+}
+
+// Normalize reduces an answer to a canonical form for comparison. Punctuation
+// and a leading article are dropped, thousands separators are removed and
+// number words are written as digits.
+func Normalize(s string) string {
+	s = CleanText(s)
+	words := strings.FieldsFunc(dropSeparators(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	if len(words) > 1 {
+		if _, ok := articles[words[0]]; ok {
+			words = words[1:]
+		}
+	}
+	return strings.Join(joinNumbers(words), " ")
+}
+
+// dropSeparators removes the commas between digits in numbers such as
+// "1,000,000".
+func dropSeparators(s string) string {
+	runes := []rune(s)
+	var b strings.Builder
+	for i, r := range runes {
+		if r == ',' && i > 0 && i+1 < len(runes) && unicode.IsDigit(runes[i-1]) && unicode.IsDigit(runes[i+1]) {
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// joinNumbers writes each run of number words as a single number, so that
+// "TWENTY ONE" becomes 21 and "ONE HUNDRED AND FIVE" becomes 105. Words that
+// cannot continue a number, as in "ONE TWO", start a new one.
+func joinNumbers(words []string) []string {
+	var out []string
+	total, current, in := 0, 0, false
+	flush := func() {
+		if in {
+			out = append(out, strconv.Itoa(total+current))
+		}
+		total, current, in = 0, 0, false
+	}
+	for i, word := range words {
+		n, ok := numberWords[word]
+		if !ok {
+			if word == "AND" && in && i+1 < len(words) {
+				if _, ok := numberWords[words[i+1]]; ok {
+					continue
+				}
+			}
+			flush()
+			out = append(out, word)
+			continue
+		}
+		switch tail := current % 100; {
+		case n == 100:
+			current = max(current, 1) * 100
+		case n == 1000:
+			total += max(current, 1) * 1000
+			current = 0
+		case in && n > 0 && (tail == 0 || tail >= 20 && tail%10 == 0 && n < 10):
+			current += n
+		default:
+			flush()
+			current = n
+		}
+		in = true
+	}
+	flush()
+	return out
+}
+
+var romanValues = map[rune]int{'I': 1, 'V': 5, 'X': 10, 'L': 50, 'C': 100, 'D': 500, 'M': 1000}
+
+// isRoman reports whether word is a well formed Roman numeral, such as the
+// "VIII" in "HENRY VIII".
+func isRoman(word string) bool {
+	n, prev := 0, 0
+	runes := []rune(word)
+	for i := len(runes) - 1; i >= 0; i-- {
+		v, ok := romanValues[runes[i]]
+		if !ok {
+			return false
+		}
+		if v < prev {
+			n -= v
+		} else {
+			n += v
+			prev = v
+		}
+	}
+	return n > 0 && n < 4000 && roman(n) == word
+}
+
+// roman writes n as a Roman numeral.
+func roman(n int) string {
+	var b strings.Builder
+	for _, numeral := range []struct {
+		V int
+		S string
+	}{
+		{1000, "M"}, {900, "CM"}, {500, "D"}, {400, "CD"}, {100, "C"}, {90, "XC"},
+		{50, "L"}, {40, "XL"}, {10, "X"}, {9, "IX"}, {5, "V"}, {4, "IV"}, {1, "I"},
+	} {
+		for n >= numeral.V {
+			b.WriteString(numeral.S)
+			n -= numeral.V
+		}
+	}
+	return b.String()
+}
+
+// splitExact separates the words of a normalised answer that must match
+// exactly, numbers and Roman numerals, from the rest written without spaces.
+func splitExact(s string) (exact []string, letters string) {
+	var b strings.Builder
+	for _, word := range strings.Fields(s) {
+		if strings.ContainsFunc(word, unicode.IsDigit) || isRoman(word) {
+			exact = append(exact, word)
+			continue
+		}
+		b.WriteString(word)
+	}
+	return exact, b.String()
+}
+
+// distance returns the Levenshtein edit distance between a and b.
+func distance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(rb)]
+}
+
+// tolerance is how many edits a guess may be from an answer of n runes and
+// still count as the same answer. Short answers must match exactly so that
+// "MILE" is not mistaken for "NILE".
+func tolerance(n int) int {
+	switch {
+	case n <= 4:
+		return 0
+	case n <= 8:
+		return 1
+	default:
+		return 2
+	}
+}
+
+// Similar reports whether guess is close enough to answer to be considered
+// the same answer. Numbers and Roman numerals must match exactly, only the
+// letters of other words may differ.
+func Similar(guess, answer string) bool {
+	guess, answer = Normalize(guess), Normalize(answer)
+	if guess == answer {
+		return true
+	}
+	guessExact, guessLetters := splitExact(guess)
+	answerExact, answerLetters := splitExact(answer)
+	if !slices.Equal(guessExact, answerExact) {
+		return false
+	}
+	// Spacing differences such as "NEW ZEALAND" and "NEWZEALAND" are free.
+	return distance(guessLetters, answerLetters) <= tolerance(len([]rune(answerLetters)))
+}
+
+// IsTruth reports whether text matches the correct answer to q or one of its
+// alternates.
+func (q *Question) IsTruth(text string) bool {
+	correct := q.CorrectAnswer()
+	if correct == nil {
+		return false
+	}
+	if Similar(text, correct.Text) {
+		return true
+	}
+	for _, alternate := range q.Alternates {
+		if Similar(text, alternate) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,214 @@
+package game
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Moderation is how strictly the text players write is filtered before it
+// is shown to the room.
+type Moderation int
+
+const (
+	// ModerationOff lets anything through.
+	ModerationOff Moderation = iota
+	// ModerationMild rejects words that are not marked strict, written on
+	// their own.
+	ModerationMild
+	// ModerationStrict rejects every listed word, along with the words
+	// that start with one, such as "badwords" or "badwordy".
+	ModerationStrict
+)
+
+// Moderator checks the text players write, returning ErrProfane if it is
+// not allowed at level.
+type Moderator interface {
+	Moderate(text string, level Moderation) error
+}
+
+// leet maps the characters commonly swapped for letters back to the letter.
+var leet = map[rune]rune{
+	'0': 'o',
+	'1': 'i',
+	'3': 'e',
+	'4': 'a',
+	'5': 's',
+	'7': 't',
+	'8': 'b',
+	'@': 'a',
+	'$': 's',
+	'!': 'i',
+	'|': 'l',
+	'+': 't',
+}
+
+// normalise breaks text into lower case words, reading leetspeak within
+// words as the letters it stands for. Runs of single letters, as in
+// "b a d" or "b.a.d", are joined into one word.
+func normalise(text string) []string {
+	var words []string
+	// single is set while the last word is a run of single letters.
+	single := false
+	for _, field := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		_, ok := leet[r]
+		return !unicode.IsLetter(r) && !ok
+	}) {
+		if !strings.ContainsFunc(field, unicode.IsLetter) {
+			// Numbers are left alone, even when they spell something.
+			continue
+		}
+		// Trailing punctuation ends a word, rather than standing for letters.
+		field = strings.TrimRightFunc(field, func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		})
+		word := strings.Map(func(r rune) rune {
+			if l, ok := leet[r]; ok {
+				return l
+			}
+			return r
+		}, field)
+		if n := len(words); n > 0 && single && utf8.RuneCountInString(word) == 1 {
+			words[n-1] += word
+			continue
+		}
+		single = utf8.RuneCountInString(word) == 1
+		words = append(words, word)
+	}
+	return words
+}
+
+// WordList is a Moderator that rejects text containing any of its words.
+type WordList struct {
+	// words maps each word to whether it is only rejected when strict.
+	words map[string]bool
+	// allowed are words that start with a listed word but are harmless,
+	// such as "arsenal".
+	allowed map[string]struct{}
+}
+
+// NewWordList reads a word list with one word a line. A word followed by
+// ",strict" is only rejected by strict moderation, a word starting with !
+// is allowed even though it starts with a listed word. Blank lines and lines
+// starting with # are ignored.
+func NewWordList(r io.Reader) (*WordList, error) {
+	l := &WordList{words: make(map[string]bool), allowed: make(map[string]struct{})}
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if word, ok := strings.CutPrefix(line, "!"); ok {
+			l.allowed[strings.Join(normalise(word), "")] = struct{}{}
+			continue
+		}
+		word, level, _ := strings.Cut(line, ",")
+		strict := false
+		switch strings.TrimSpace(level) {
+		case "":
+		case "strict":
+			strict = true
+		default:
+			return nil, fmt.Errorf("Line %d: unknown level %q", n, level)
+		}
+		normal := strings.Join(normalise(word), "")
+		if normal == "" {
+			return nil, fmt.Errorf("Line %d: no word", n)
+		}
+		l.words[normal] = strict
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// LoadWordList reads the word list at path.
+func LoadWordList(path string) (*WordList, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	l, err := NewWordList(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+	return l, nil
+}
+
+// defaultWords is a short list for rooms with no list of their own.
+const defaultWords = `# Rejected unless moderation is off.
+fuck
+fucking
+motherfucker
+shit
+bullshit
+cunt
+bitch
+bastard
+asshole
+wanker
+twat
+dickhead
+# Only rejected by strict moderation.
+arse,strict
+crap,strict
+damn,strict
+piss,strict
+bollocks,strict
+bloody,strict
+sex,strict
+boobs,strict
+# Allowed, though they start with a word above.
+!arsenal
+!arsenic
+!sextant
+!sextet
+!sexton
+`
+
+// DefaultWordList returns a short built in word list.
+func DefaultWordList() *WordList {
+	l, err := NewWordList(strings.NewReader(defaultWords))
+	if err != nil {
+		panic(err)
+	}
+	return l
+}
+
+// Moderate rejects text containing a word in the list, at level. Only the
+// letters of a single word, or of a run of single letters, are matched
+// together.
+func (l *WordList) Moderate(text string, level Moderation) error {
+	if level == ModerationOff {
+		return nil
+	}
+	words := normalise(text)
+	for _, word := range words {
+		if strict, ok := l.words[word]; ok && (!strict || level >= ModerationStrict) {
+			return ErrProfane
+		}
+	}
+	if level < ModerationStrict {
+		return nil
+	}
+	// Each word is checked on its own, so that "has hit" is not read as
+	// "shit".
+	for _, word := range words {
+		if _, ok := l.allowed[word]; ok {
+			continue
+		}
+		for listed := range l.words {
+			if strings.HasPrefix(word, listed) {
+				return ErrProfane
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,175 @@
+package game
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ParseNumber reads a number as players and packs are likely to write it,
+// allowing for spaces and thousands separators.
+func ParseNumber(text string) (float64, error) {
+	text = strings.NewReplacer(",", "", " ", "").Replace(text)
+	value, err := strconv.ParseFloat(text, 64)
+	if err != nil || math.IsNaN(value) || math.IsInf(value, 0) {
+		return 0, ErrNotNumber
+	}
+	return value, nil
+}
+
+// FormatNumber writes value in its shortest form.
+func FormatNumber(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
+
+// NumberCollector collects a numeric guess from each player. Players may
+// make the same guess.
+type NumberCollector struct {
+	Question  *Question
+	Remaining int
+}
+
+func (c *NumberCollector) Collect(player Player, text string) error {
+	if c.Complete() {
+		return ErrCompleted
+	}
+	if c.answered(player) {
+		return ErrCompleted
+	}
+	value, err := ParseNumber(text)
+	if err != nil {
+		return err
+	}
+	c.Question.Answers = append(c.Question.Answers, &Answer{
+		Text:   FormatNumber(value),
+		Player: player,
+	})
+	c.Remaining--
+	return nil
+}
+
+func (c *NumberCollector) Complete() bool {
+	return c.Remaining <= 0
+}
+
+func (c *NumberCollector) answered(player Player) bool {
+	for _, a := range c.Question.Answers {
+		if a.Player == player {
+			return true
+		}
+	}
+	return false
+}
+
+// Add expects a guess from a player who has returned.
+func (c *NumberCollector) Add(player Player) {
+	if !c.answered(player) {
+		c.Remaining++
+	}
+}
+
+// Remove stops waiting on a guess from a player who has gone away.
+func (c *NumberCollector) Remove(player Player) {
+	if !c.answered(player) {
+		c.Remaining--
+	}
+}
+
+// NewNumberResultSet ranks the guesses by their distance from the truth. The
+// closest guesses score the correct points, each rank further away scores
+// less, down to a share of the points for the furthest.
+func NewNumberResultSet(q *Question, rules *Rules) ResultSet {
+	r := make(map[*Answer][]Result)
+	truth, err := ParseNumber(q.CorrectAnswer().Text)
+	if err != nil {
+		return r
+	}
+	distance := func(answer *Answer) float64 {
+		value, _ := ParseNumber(answer.Text)
+		return math.Abs(value - truth)
+	}
+	var distances []float64
+	seen := make(map[float64]struct{})
+	for _, answer := range q.Answers {
+		if answer.Correct || answer.Player == nil {
+			continue
+		}
+		d := distance(answer)
+		if _, ok := seen[d]; !ok {
+			seen[d] = struct{}{}
+			distances = append(distances, d)
+		}
+	}
+	sort.Float64s(distances)
+	for _, answer := range q.Answers {
+		if answer.Correct || answer.Player == nil {
+			continue
+		}
+		rank := sort.SearchFloat64s(distances, distance(answer))
+		r[answer] = append(r[answer], Result{
+			Player: answer.Player,
+			Offset: rules.CorrectPoints * (len(distances) - rank) / len(distances) * q.Multiplier,
+		})
+	}
+	return r
+}
+
+// NumberRound is played on questions with a numeric answer. Players guess
+// the number and score by how close they come, there is no vote.
+type NumberRound struct {
+	question *Question
+	rules    *Rules
+}
+
+func NewNumberRound(question *Question, rules *Rules) *NumberRound {
+	return &NumberRound{question: question, rules: rules}
+}
+
+func (r *NumberRound) Question() *Question {
+	return r.question
+}
+
+func (r *NumberRound) Phases() []Phase {
+	return []Phase{PhaseAnswer}
+}
+
+func (r *NumberRound) Collector(phase Phase, remaining int) Collector {
+	if phase == PhaseAnswer {
+		return &NumberCollector{Question: r.question, Remaining: remaining}
+	}
+	return NonCollector{}
+}
+
+func (r *NumberRound) Time(phase Phase) time.Duration {
+	return r.rules.AnswerTime()
+}
+
+func (r *NumberRound) Announce(host Host, phase Phase, deadline time.Time) {
+	if phase == PhaseAnswer {
+		host.Question(r.question, deadline)
+	}
+}
+
+func (r *NumberRound) Prompt(player Player, phase Phase, deadline time.Time) {
+	if phase == PhaseAnswer {
+		player.RequestAnswer(r.question.Text, deadline)
+	}
+}
+
+// PromptAudience does nothing, the audience has nothing to vote on.
+func (r *NumberRound) PromptAudience(audience Player, phase Phase, deadline time.Time) {}
+
+func (r *NumberRound) Pending(player Player, phase Phase) bool {
+	for _, answer := range r.question.Answers {
+		if answer.Player == player {
+			return false
+		}
+	}
+	return true
+}
+
+func (r *NumberRound) Score() ResultSet {
+	return NewNumberResultSet(r.question, r.rules)
+}
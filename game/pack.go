@@ -0,0 +1,157 @@
+package game
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// csvColumns are the columns understood in a CSV pack with a header row.
+var csvColumns = []string{"question", "answer", "alternates", "category", "difficulty", "source", "kind"}
+
+// csvHeader maps column names to their index if row is a header, or returns
+// nil if row is data.
+func csvHeader(row []string) (map[string]int, error) {
+	if !strings.EqualFold(strings.TrimSpace(row[0]), "question") {
+		return nil, nil
+	}
+	columns := make(map[string]int)
+	for i, name := range row {
+		name = strings.ToLower(strings.TrimSpace(name))
+		known := false
+		for _, column := range csvColumns {
+			if name == column {
+				known = true
+			}
+		}
+		if !known {
+			return nil, fmt.Errorf("Unknown column: %s", name)
+		}
+		columns[name] = i
+	}
+	if _, ok := columns["answer"]; !ok {
+		return nil, fmt.Errorf("Missing column: answer")
+	}
+	return columns, nil
+}
+
+func csvRecord(row []string, columns map[string]int) record {
+	if columns == nil {
+		return record{Question: row[0], Answer: row[1]}
+	}
+	field := func(name string) string {
+		if i, ok := columns[name]; ok {
+			return strings.TrimSpace(row[i])
+		}
+		return ""
+	}
+	r := record{
+		Question:   field("question"),
+		Answer:     field("answer"),
+		Category:   field("category"),
+		Difficulty: field("difficulty"),
+		Source:     field("source"),
+		Kind:       field("kind"),
+	}
+	// Alternate answers share a column, separated by '|'.
+	for _, alternate := range strings.Split(field("alternates"), "|") {
+		if alternate = strings.TrimSpace(alternate); alternate != "" {
+			r.Alternates = append(r.Alternates, alternate)
+		}
+	}
+	return r
+}
+
+type packFile struct {
+	Title       string
+	Description string
+	Questions   []record
+}
+
+// NewQuestionRepoJSON reads a JSON question pack of the form:
+//
+//	{
+//	  "title": "Rivers",
+//	  "description": "Rivers of the world",
+//	  "questions": [
+//	    {
+//	      "question": "Which river flows through Cairo?",
+//	      "answer": "Nile",
+//	      "alternates": ["River Nile"],
+//	      "category": "Geography",
+//	      "difficulty": "easy",
+//	      "source": "Atlas"
+//	    },
+//	    {
+//	      "question": "How long is the Nile in kilometres?",
+//	      "answer": "6650",
+//	      "kind": "number"
+//	    }
+//	  ]
+//	}
+func NewQuestionRepoJSON(r io.Reader) (*QuestionRepo, error) {
+	var pack packFile
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&pack); err != nil {
+		return nil, err
+	}
+	repo, err := newQuestionRepo(pack.Questions)
+	if err != nil {
+		return nil, err
+	}
+	repo.Title = strings.TrimSpace(pack.Title)
+	repo.Description = strings.TrimSpace(pack.Description)
+	return repo, nil
+}
+
+// OpenQuestionRepo loads the question pack at path, choosing the format from
+// its extension.
+func OpenQuestionRepo(path string) (*QuestionRepo, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var repo *QuestionRepo
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		repo, err = NewQuestionRepoJSON(f)
+	} else {
+		repo, err = NewQuestionRepo(f)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+	return repo, nil
+}
+
+// PackName returns the name a pack file is known by.
+func PackName(path string) string {
+	base := filepath.Base(path)
+	return strings.TrimSuffix(base, filepath.Ext(base))
+}
+
+// MergeQuestionRepos combines repos into a single repo, dropping questions
+// that appear in more than one. The repos are not modified.
+func MergeQuestionRepos(repos ...*QuestionRepo) *QuestionRepo {
+	if len(repos) == 1 {
+		return repos[0]
+	}
+	merged := &QuestionRepo{}
+	seen := make(map[string]struct{})
+	for _, repo := range repos {
+		for _, record := range repo.records {
+			key := CleanText(record.Question)
+			if _, ok := seen[key]; ok {
+				continue
+			}
+			seen[key] = struct{}{}
+			merged.records = append(merged.records, record)
+		}
+	}
+	merged.indexAnswers()
+	return merged
+}
@@ -0,0 +1,185 @@
+package game
+
+import (
+	"time"
+)
+
+// Round is one question of a game. Each round runs through its own phases
+// in order, collecting from players in each, before it is scored. The game
+// only sequences rounds and phases, so a new mode of play is added by
+// implementing Round.
+type Round interface {
+	Question() *Question
+	// Phases returns the phases players take part in, in order. The results
+	// phase follows the last of them.
+	Phases() []Phase
+	// Collector returns the collector for phase, expecting remaining players
+	// to take part.
+	Collector(phase Phase, remaining int) Collector
+	// Time returns how long players have to complete phase.
+	Time(phase Phase) time.Duration
+	// Announce tells the host that phase has begun.
+	Announce(host Host, phase Phase, deadline time.Time)
+	// Prompt asks player for their part in phase.
+	Prompt(player Player, phase Phase, deadline time.Time)
+	// PromptAudience asks an audience member for their part in phase, if
+	// they have one.
+	PromptAudience(audience Player, phase Phase, deadline time.Time)
+	// Pending reports whether player, or audience member, has yet to take
+	// their part in phase.
+	Pending(player Player, phase Phase) bool
+	// Score returns the results of the round once its last phase closes.
+	Score() ResultSet
+}
+
+// AudienceCollector is implemented by collectors that accept input from the
+// audience.
+type AudienceCollector interface {
+	CollectAudience(player Player, text string) error
+}
+
+// LikeCollector is implemented by collectors of phases where answers may be
+// liked.
+type LikeCollector interface {
+	Like(player Player, text string) error
+}
+
+// Kinds of question, each played with its own kind of round.
+const (
+	KindLie    = "lie"
+	KindNumber = "number"
+)
+
+// NewRound returns the round to be played on question, according to its kind.
+func NewRound(question *Question, rules *Rules) Round {
+	switch question.Kind {
+	case KindNumber:
+		return NewNumberRound(question, rules)
+	}
+	return NewLieRound(question, rules)
+}
+
+// LieRound is the classic round. Players write lies to pass off as the
+// truth, then vote for the answer they believe is true.
+type LieRound struct {
+	question *Question
+	rules    *Rules
+}
+
+func NewLieRound(question *Question, rules *Rules) *LieRound {
+	return &LieRound{question: question, rules: rules}
+}
+
+func (r *LieRound) Question() *Question {
+	return r.question
+}
+
+func (r *LieRound) Phases() []Phase {
+	return []Phase{PhaseAnswer, PhaseVote}
+}
+
+func (r *LieRound) Collector(phase Phase, remaining int) Collector {
+	switch phase {
+	case PhaseAnswer:
+		return &AnswerCollector{
+			Question:  r.question,
+			Remaining: remaining,
+			Rules:     r.rules,
+		}
+	case PhaseVote:
+		collector := VoteCollector{
+			Question:  r.question,
+			Remaining: remaining,
+		}
+		if r.question.Final {
+			return &FinalVoteCollector{VoteCollector: collector}
+		}
+		return &collector
+	}
+	return NonCollector{}
+}
+
+func (r *LieRound) Time(phase Phase) time.Duration {
+	if phase == PhaseVote {
+		return r.rules.VoteTime()
+	}
+	return r.rules.AnswerTime()
+}
+
+func (r *LieRound) Announce(host Host, phase Phase, deadline time.Time) {
+	switch phase {
+	case PhaseAnswer:
+		host.Question(r.question, deadline)
+	case PhaseVote:
+		host.Vote(r.question, deadline)
+	}
+}
+
+// answers returns the answers player may vote for, every answer but their
+// own.
+func (r *LieRound) answers(player Player) []string {
+	var answers []string
+	for _, answer := range r.question.Answers {
+		if answer.Player == nil || answer.Player != player {
+			answers = append(answers, answer.Text)
+		}
+	}
+	return answers
+}
+
+// firstChoice returns the answer player picked first in the final round, if
+// they have picked one.
+func (r *LieRound) firstChoice(player Player) string {
+	for _, answer := range r.question.Answers {
+		if answer.HasVoted(player) {
+			return answer.Text
+		}
+	}
+	return ""
+}
+
+func (r *LieRound) Prompt(player Player, phase Phase, deadline time.Time) {
+	switch phase {
+	case PhaseAnswer:
+		player.RequestAnswer(r.question.Text, deadline)
+	case PhaseVote:
+		if r.question.Final {
+			player.RequestFinalVote(r.question.Text, r.answers(player), r.firstChoice(player), deadline)
+			return
+		}
+		player.RequestVote(r.question.Text, r.answers(player), deadline)
+	}
+}
+
+// PromptAudience asks the audience to vote, even in the final round.
+func (r *LieRound) PromptAudience(audience Player, phase Phase, deadline time.Time) {
+	if phase == PhaseVote {
+		audience.RequestVote(r.question.Text, r.answers(audience), deadline)
+	}
+}
+
+func (r *LieRound) Pending(player Player, phase Phase) bool {
+	for _, answer := range r.question.Answers {
+		switch phase {
+		case PhaseAnswer:
+			if answer.Player == player {
+				return false
+			}
+		case PhaseVote:
+			if answer.HasSecondVote(player) || answer.HasAudienceVote(player) {
+				return false
+			}
+			if answer.HasVoted(player) && !r.question.Final {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func (r *LieRound) Score() ResultSet {
+	if r.question.Final {
+		return NewFinalResultSet(r.question, r.rules)
+	}
+	return NewResultSet(r.question, r.rules)
+}
@@ -0,0 +1,181 @@
+package game
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// maxPlayers is the most players any game can hold, the host screen has a
+// slot for each of them.
+const maxPlayers = 8
+
+// Rules configures the scoring, pacing and limits of a game.
+type Rules struct {
+	// CreatorPoints are awarded to the author of a lie for each player it
+	// fools.
+	CreatorPoints int
+	// CorrectPoints are awarded for voting for the truth.
+	CorrectPoints int
+	// TruthPoints are awarded for submitting the truth as a lie, zero
+	// disables the award.
+	TruthPoints int
+	// AudiencePoints are awarded to the author of the lie the audience
+	// votes for most, zero disables the award.
+	AudiencePoints int
+	// Rounds is the number of questions in a game.
+	Rounds int
+	// Multipliers scales the points of each round in turn. Rounds beyond the
+	// end of the schedule use the last multiplier.
+	Multipliers []int
+	// FinalRound makes the last question of a game of more than one round a
+	// final round, where players pick a first and second choice.
+	FinalRound bool
+	// SecondCorrectPoints are awarded for picking the truth as a second
+	// choice in the final round.
+	SecondCorrectPoints int
+	// SecondCreatorPoints are awarded to the author of a lie for each player
+	// who picks it as their second choice in the final round.
+	SecondCreatorPoints int
+	MaxPlayers          int
+	MaxAudience         int
+	MinAnswerLength     int
+	MaxAnswerLength     int
+	AnswerSeconds       int
+	VoteSeconds         int
+	// Moderation is how strictly player names and lies are filtered.
+	Moderation Moderation
+}
+
+// DefaultRules returns the classic rules.
+func DefaultRules() *Rules {
+	return &Rules{
+		CreatorPoints:       1000,
+		CorrectPoints:       1500,
+		Rounds:              7,
+		Multipliers:         []int{1, 1, 1, 2, 2, 2, 3},
+		FinalRound:          true,
+		SecondCorrectPoints: 750,
+		SecondCreatorPoints: 500,
+		MaxPlayers:          maxPlayers,
+		MaxAudience:         100,
+		MinAnswerLength:     1,
+		MaxAnswerLength:     50,
+		AnswerSeconds:       30,
+		VoteSeconds:         30,
+		Moderation:          ModerationMild,
+	}
+}
+
+// Presets are named variations on the default rules.
+var Presets = map[string]func() *Rules{
+	"classic": DefaultRules,
+	"party": func() *Rules {
+		r := DefaultRules()
+		r.Rounds = 5
+		r.Multipliers = []int{1, 1, 2, 2, 3}
+		r.TruthPoints = 500
+		r.AudiencePoints = 500
+		r.AnswerSeconds = 20
+		r.VoteSeconds = 20
+		return r
+	},
+	"family": func() *Rules {
+		r := DefaultRules()
+		r.MaxAnswerLength = 30
+		r.AnswerSeconds = 60
+		r.VoteSeconds = 45
+		r.Moderation = ModerationStrict
+		return r
+	},
+	"stream": func() *Rules {
+		// Streams run behind the room, so leave time for the delay.
+		r := DefaultRules()
+		r.AnswerSeconds = 45
+		r.VoteSeconds = 40
+		r.AudiencePoints = 500
+		return r
+	},
+}
+
+// PresetNames returns the names of the presets in order.
+func PresetNames() []string {
+	names := make([]string, 0, len(Presets))
+	for name := range Presets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Preset returns a copy of the named preset.
+func Preset(name string) (*Rules, error) {
+	if name == "" {
+		return DefaultRules(), nil
+	}
+	preset, ok := Presets[name]
+	if !ok {
+		return nil, fmt.Errorf("Unknown rules preset: %s", name)
+	}
+	return preset(), nil
+}
+
+func checkRange(name string, v, min, max int) error {
+	if v < min || v > max {
+		return fmt.Errorf("%s must be between %d and %d", name, min, max)
+	}
+	return nil
+}
+
+// Validate checks that the rules describe a playable game.
+func (r *Rules) Validate() error {
+	for _, check := range []struct {
+		Name     string
+		V        int
+		Min, Max int
+	}{
+		{"CreatorPoints", r.CreatorPoints, 0, 100000},
+		{"CorrectPoints", r.CorrectPoints, 0, 100000},
+		{"TruthPoints", r.TruthPoints, 0, 100000},
+		{"AudiencePoints", r.AudiencePoints, 0, 100000},
+		{"SecondCorrectPoints", r.SecondCorrectPoints, 0, 100000},
+		{"SecondCreatorPoints", r.SecondCreatorPoints, 0, 100000},
+		{"Rounds", r.Rounds, 1, 20},
+		{"MaxPlayers", r.MaxPlayers, 1, maxPlayers},
+		{"MaxAudience", r.MaxAudience, 0, 1000},
+		{"MinAnswerLength", r.MinAnswerLength, 1, 100},
+		{"MaxAnswerLength", r.MaxAnswerLength, r.MinAnswerLength, 100},
+		{"AnswerSeconds", r.AnswerSeconds, 5, 300},
+		{"VoteSeconds", r.VoteSeconds, 5, 300},
+		{"Moderation", int(r.Moderation), int(ModerationOff), int(ModerationStrict)},
+	} {
+		if err := checkRange(check.Name, check.V, check.Min, check.Max); err != nil {
+			return err
+		}
+	}
+	if len(r.Multipliers) < 1 {
+		return fmt.Errorf("Multipliers must not be empty")
+	}
+	for _, m := range r.Multipliers {
+		if err := checkRange("Multipliers", m, 1, 10); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Multiplier returns the multiplier for the round at index i.
+func (r *Rules) Multiplier(i int) int {
+	if i < len(r.Multipliers) {
+		return r.Multipliers[i]
+	}
+	return r.Multipliers[len(r.Multipliers)-1]
+}
+
+func (r *Rules) AnswerTime() time.Duration {
+	return time.Duration(r.AnswerSeconds) * time.Second
+}
+
+func (r *Rules) VoteTime() time.Duration {
+	return time.Duration(r.VoteSeconds) * time.Second
+}
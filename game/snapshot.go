@@ -0,0 +1,280 @@
+package game
+
+import (
+	"fmt"
+	"time"
+)
+
+// resumeTime is the least time a restored phase is given, so that players
+// have a chance to reconnect before it closes.
+const resumeTime = 15 * time.Second
+
+// Snapshot is the state of a game with players identified by ID, so that it
+// can be saved and the game restored later. The audience is left out, along
+// with their votes: unlike players they leave as soon as their connection
+// drops, and a restart drops every connection.
+type Snapshot struct {
+	Rules     *Rules
+	Questions []QuestionSnapshot
+	Players   map[string]int
+	Away      []string `json:",omitempty"`
+	Current   int
+	Step      int
+	Phase     Phase
+	Deadline  time.Time
+	// Scores holds the results of each round scored so far.
+	Scores [][]ResultSnapshot `json:",omitempty"`
+}
+
+type QuestionSnapshot struct {
+	Text       string
+	Category   string   `json:",omitempty"`
+	Difficulty string   `json:",omitempty"`
+	Source     string   `json:",omitempty"`
+	Kind       string   `json:",omitempty"`
+	Alternates []string `json:",omitempty"`
+	Multiplier int
+	Final      bool `json:",omitempty"`
+	Answers    []AnswerSnapshot
+	Guessed    []string `json:",omitempty"`
+}
+
+type AnswerSnapshot struct {
+	Correct     bool `json:",omitempty"`
+	Text        string
+	Player      string   `json:",omitempty"`
+	Votes       []string `json:",omitempty"`
+	SecondVotes []string `json:",omitempty"`
+	Likes       []string `json:",omitempty"`
+}
+
+// ResultSnapshot is a Result with the index of the answer it was scored on.
+type ResultSnapshot struct {
+	Answer   int
+	Player   string
+	Offset   int
+	Audience bool `json:",omitempty"`
+}
+
+func (p *Phase) UnmarshalText(text []byte) error {
+	for i, name := range phaseNames {
+		if name == string(text) {
+			*p = Phase(i)
+			return nil
+		}
+	}
+	return fmt.Errorf("Unknown phase: %s", text)
+}
+
+// Snapshot returns the state of the game, naming each player with id.
+func (g *Game) Snapshot(id func(Player) string) *Snapshot {
+	ids := func(players []Player) []string {
+		var s []string
+		for _, player := range players {
+			s = append(s, id(player))
+		}
+		return s
+	}
+	s := &Snapshot{
+		Rules:    g.Rules,
+		Players:  make(map[string]int),
+		Current:  g.current,
+		Step:     g.step,
+		Phase:    g.phase,
+		Deadline: g.deadline,
+	}
+	for _, question := range g.Questions {
+		q := QuestionSnapshot{
+			Text:       question.Text,
+			Category:   question.Category,
+			Difficulty: question.Difficulty,
+			Source:     question.Source,
+			Kind:       question.Kind,
+			Alternates: question.Alternates,
+			Multiplier: question.Multiplier,
+			Final:      question.Final,
+			Guessed:    ids(question.Guessed),
+		}
+		for _, answer := range question.Answers {
+			a := AnswerSnapshot{
+				Correct:     answer.Correct,
+				Text:        answer.Text,
+				Votes:       ids(answer.Votes),
+				SecondVotes: ids(answer.SecondVotes),
+				Likes:       ids(g.withoutAudience(answer.Likes)),
+			}
+			if answer.Player != nil {
+				a.Player = id(answer.Player)
+			}
+			q.Answers = append(q.Answers, a)
+		}
+		s.Questions = append(s.Questions, q)
+	}
+	for player, score := range g.Players {
+		s.Players[id(player)] = score
+	}
+	for player := range g.away {
+		s.Away = append(s.Away, id(player))
+	}
+	for i, results := range g.scores {
+		var scores []ResultSnapshot
+		for j, answer := range g.Questions[i].Answers {
+			for _, result := range results[answer] {
+				scores = append(scores, ResultSnapshot{
+					Answer:   j,
+					Player:   id(result.Player),
+					Offset:   result.Offset,
+					Audience: result.Audience,
+				})
+			}
+		}
+		s.Scores = append(s.Scores, scores)
+	}
+	return s
+}
+
+// withoutAudience returns players without any members of the audience.
+func (g *Game) withoutAudience(players []Player) []Player {
+	var kept []Player
+	for _, player := range players {
+		if !g.IsAudience(player) {
+			kept = append(kept, player)
+		}
+	}
+	return kept
+}
+
+// Restore recreates the game in s, finding each player by ID with player.
+// The players named in away are marked away, whatever their state in s. The
+// restored game has no deadline until Resume is called.
+func Restore(s *Snapshot, host Host, player func(id string) Player, away []string) (*Game, error) {
+	if s.Rules == nil {
+		return nil, fmt.Errorf("Snapshot has no rules")
+	}
+	var err error
+	lookup := func(id string) Player {
+		p := player(id)
+		if p == nil && err == nil {
+			err = fmt.Errorf("Unknown player: %s", id)
+		}
+		return p
+	}
+	// Likes do not score, so those of anyone who cannot be found are dropped
+	// rather than losing the game.
+	known := func(ids []string) []Player {
+		var players []Player
+		for _, id := range ids {
+			if p := player(id); p != nil {
+				players = append(players, p)
+			}
+		}
+		return players
+	}
+	lookupAll := func(ids []string) []Player {
+		var players []Player
+		for _, id := range ids {
+			players = append(players, lookup(id))
+		}
+		return players
+	}
+	g := &Game{
+		Host:      host,
+		Rules:     s.Rules,
+		Players:   make(map[Player]int),
+		Audience:  make(map[Player]struct{}),
+		Clock:     SystemClock,
+		away:      make(map[Player]struct{}),
+		current:   s.Current,
+		step:      s.Step,
+		phase:     s.Phase,
+		deadline:  s.Deadline,
+		collector: NonCollector{},
+	}
+	for _, q := range s.Questions {
+		question := &Question{
+			Text:       q.Text,
+			Category:   q.Category,
+			Difficulty: q.Difficulty,
+			Source:     q.Source,
+			Kind:       q.Kind,
+			Alternates: q.Alternates,
+			Multiplier: q.Multiplier,
+			Final:      q.Final,
+			Guessed:    lookupAll(q.Guessed),
+		}
+		for _, a := range q.Answers {
+			answer := &Answer{
+				Correct:     a.Correct,
+				Text:        a.Text,
+				Votes:       lookupAll(a.Votes),
+				SecondVotes: lookupAll(a.SecondVotes),
+				Likes:       known(a.Likes),
+			}
+			if a.Player != "" {
+				answer.Player = lookup(a.Player)
+			}
+			question.Answers = append(question.Answers, answer)
+		}
+		g.Questions = append(g.Questions, question)
+		g.Rounds = append(g.Rounds, NewRound(question, s.Rules))
+	}
+	for id, score := range s.Players {
+		g.Players[lookup(id)] = score
+	}
+	for _, id := range append(s.Away, away...) {
+		if _, ok := g.Players[player(id)]; ok {
+			g.away[player(id)] = struct{}{}
+		}
+	}
+	if len(s.Scores) > len(g.Questions) {
+		return nil, fmt.Errorf("Snapshot has more scores than questions")
+	}
+	for i, scores := range s.Scores {
+		results := make(ResultSet)
+		answers := g.Questions[i].Answers
+		for _, r := range scores {
+			if r.Answer < 0 || r.Answer >= len(answers) {
+				return nil, fmt.Errorf("Snapshot scores unknown answer %d", r.Answer)
+			}
+			results[answers[r.Answer]] = append(results[answers[r.Answer]], Result{
+				Player:   lookup(r.Player),
+				Offset:   r.Offset,
+				Audience: r.Audience,
+			})
+		}
+		g.scores = append(g.scores, results)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(g.scores) > 0 {
+		g.results = g.scores[len(g.scores)-1]
+	}
+	if g.playing() {
+		if g.current < 0 || g.current >= len(g.Rounds) || g.step < 0 || g.step >= len(g.round().Phases()) {
+			return nil, fmt.Errorf("Snapshot is in an unknown round")
+		}
+		round := g.round()
+		remaining := 0
+		for p := range g.Players {
+			if !g.IsAway(p) && round.Pending(p, g.phase) {
+				remaining++
+			}
+		}
+		g.collector = round.Collector(g.phase, remaining)
+	}
+	return g, nil
+}
+
+// Resume restarts the deadline of a restored phase, allowing at least
+// resumeTime for it to close.
+func (g *Game) Resume() {
+	if !g.playing() {
+		return
+	}
+	d := g.deadline.Sub(g.Clock.Now())
+	if d < resumeTime {
+		d = resumeTime
+	}
+	g.startTimer(d)
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/proglottis/tvgame/game"
+	"github.com/proglottis/tvgame/store"
+)
+
+func playerName(player game.Player) string {
+	if player == nil {
+		return ""
+	}
+	return player.(*RoomPlayer).Name
+}
+
+func playerNames(players []game.Player) []string {
+	var names []string
+	for _, player := range players {
+		names = append(names, playerName(player))
+	}
+	return names
+}
+
+// gameRecord describes the completed game g, played in room code, for the
+// store.
+func gameRecord(code string, g *game.Game) *store.Game {
+	record := &store.Game{
+		Room:     code,
+		Finished: time.Now(),
+	}
+	for i, results := range g.Scores() {
+		question := g.Questions[i]
+		round := store.Round{
+			Question:   question.Text,
+			Kind:       question.Kind,
+			Multiplier: question.Multiplier,
+		}
+		for _, answer := range question.Answers {
+			round.Answers = append(round.Answers, store.Answer{
+				Text:    answer.Text,
+				Correct: answer.Correct,
+				Player:  playerName(answer.Player),
+				Votes:   playerNames(append(answer.Votes, answer.SecondVotes...)),
+				Likes:   playerNames(answer.Likes),
+			})
+		}
+		for _, offsets := range results {
+			for _, offset := range offsets {
+				round.Offsets = append(round.Offsets, store.Offset{
+					Player: playerName(offset.Player),
+					Offset: offset.Offset,
+				})
+			}
+		}
+		record.Rounds = append(record.Rounds, round)
+	}
+	for player, total := range g.Players {
+		record.Totals = append(record.Totals, store.Total{Player: playerName(player), Total: total})
+	}
+	sort.Slice(record.Totals, func(i, j int) bool {
+		return record.Totals[i].Total > record.Totals[j].Total
+	})
+	return record
+}
+
+// saveGame writes record to s in the background, so the room is not held up
+// by the disk. The write is added to saves so that the store can be left
+// open until it is done.
+func saveGame(s store.Store, saves *sync.WaitGroup, record *store.Game) {
+	saves.Add(1)
+	go func() {
+		defer saves.Done()
+		if err := s.SaveGame(record); err != nil {
+			slog.Error("Save game failed", "room", record.Room, "err", err)
+		}
+	}()
+}
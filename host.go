@@ -3,13 +3,39 @@ package main
 import (
 	"context"
 	"encoding/json"
-	"log"
+	"sync"
+	"time"
 
 	"github.com/proglottis/tvgame/game"
 )
 
 type RoomHost struct {
-	Conn *Conn
+	Token string
+
+	mu   sync.Mutex
+	conn *Conn
+}
+
+func NewRoomHost(conn *Conn) *RoomHost {
+	return &RoomHost{Token: generateToken(), conn: conn}
+}
+
+// Conn returns the connection the host is currently using.
+func (h *RoomHost) Conn() *Conn {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.conn
+}
+
+// setConn binds the host to a new connection, closing the old one.
+func (h *RoomHost) setConn(conn *Conn) {
+	h.mu.Lock()
+	old := h.conn
+	h.conn = conn
+	h.mu.Unlock()
+	if old != nil && old != conn {
+		old.Close()
+	}
 }
 
 type joinedMessage struct {
@@ -21,39 +47,66 @@ func (h *RoomHost) Joined(player game.Player) {
 	msg := ConnMessage{Type: "joined"}
 	msg.Data, err = json.Marshal(joinedMessage{Player: player})
 	if err != nil {
-		log.Printf("RoomHost: %s", err)
-		h.Conn.Close()
+		h.Conn().Log().Error("Encode message failed", "err", err)
+		h.Conn().Close()
 		return
 	}
-	h.Conn.Write(&msg)
+	h.Conn().Write(&msg)
+}
+
+type leftMessage struct {
+	Player   game.Player
+	Complete bool
+}
+
+func (h *RoomHost) Left(player game.Player, complete bool) {
+	var err error
+	msg := ConnMessage{Type: "left"}
+	msg.Data, err = json.Marshal(leftMessage{Player: player, Complete: complete})
+	if err != nil {
+		h.Conn().Log().Error("Encode message failed", "err", err)
+		h.Conn().Close()
+		return
+	}
+	h.Conn().Write(&msg)
 }
 
 type questionMessage struct {
 	Question *game.Question
+	Deadline time.Time
+	Seconds  int
+}
+
+func newQuestionMessage(question *game.Question, deadline time.Time) questionMessage {
+	return questionMessage{
+		Question: question,
+		Deadline: deadline,
+		Seconds:  secondsUntil(deadline),
+	}
 }
 
-func (h *RoomHost) Question(question *game.Question) {
+func (h *RoomHost) Question(question *game.Question, deadline time.Time) {
 	var err error
 	msg := ConnMessage{Type: "question"}
-	msg.Data, err = json.Marshal(questionMessage{Question: question})
+	msg.Data, err = json.Marshal(newQuestionMessage(question, deadline))
 	if err != nil {
-		log.Printf("RoomHost: %s", err)
-		h.Conn.Close()
+		h.Conn().Log().Error("Encode message failed", "err", err)
+		h.Conn().Close()
 		return
 	}
-	h.Conn.Write(&msg)
+	h.Conn().Write(&msg)
 }
 
-func (h *RoomHost) Vote(question *game.Question) {
+func (h *RoomHost) Vote(question *game.Question, deadline time.Time) {
 	var err error
 	msg := ConnMessage{Type: "vote"}
-	msg.Data, err = json.Marshal(questionMessage{Question: question})
+	msg.Data, err = json.Marshal(newQuestionMessage(question, deadline))
 	if err != nil {
-		log.Printf("RoomHost: %s", err)
-		h.Conn.Close()
+		h.Conn().Log().Error("Encode message failed", "err", err)
+		h.Conn().Close()
 		return
 	}
-	h.Conn.Write(&msg)
+	h.Conn().Write(&msg)
 }
 
 type collectedMessage struct {
@@ -66,16 +119,18 @@ func (h *RoomHost) Collected(player game.Player, complete bool) {
 	msg := ConnMessage{Type: "collected"}
 	msg.Data, err = json.Marshal(collectedMessage{Player: player, Complete: complete})
 	if err != nil {
-		log.Printf("RoomHost: %s", err)
-		h.Conn.Close()
+		h.Conn().Log().Error("Encode message failed", "err", err)
+		h.Conn().Close()
 		return
 	}
-	h.Conn.Write(&msg)
+	h.Conn().Write(&msg)
 }
 
 type resultPoints struct {
 	Player game.Player
 	Total  int
+	// Likes is the separate track of likes the player's lies have received.
+	Likes int
 }
 
 type resultOffsets struct {
@@ -84,67 +139,208 @@ type resultOffsets struct {
 }
 
 type resultsMessage struct {
-	Points  []resultPoints
-	Offsets []resultOffsets `json:",omitempty"`
+	Points   []resultPoints
+	Offsets  []resultOffsets `json:",omitempty"`
+	Question *game.Question  `json:",omitempty"`
+	Funniest []game.Player   `json:",omitempty"`
 }
 
-func (h *RoomHost) Results(game *game.Game, results game.ResultSet) {
-	var err error
+func newResultsMessage(g *game.Game, results game.ResultSet) *resultsMessage {
 	data := &resultsMessage{}
-	for player, total := range game.Players {
-		data.Points = append(data.Points, resultPoints{Player: player, Total: total})
+	likes := g.Likes()
+	for player, total := range g.Players {
+		data.Points = append(data.Points, resultPoints{Player: player, Total: total, Likes: likes[player]})
 	}
 	for answer, result := range results {
 		data.Offsets = append(data.Offsets, resultOffsets{Answer: answer, Offsets: result})
 	}
+	return data
+}
+
+func (h *RoomHost) Results(game *game.Game, results game.ResultSet) {
+	var err error
+	data := newResultsMessage(game, results)
+	// The question carries every answer, including those nobody voted for,
+	// so the host can show the likes each one received.
+	data.Question = game.Current()
 	msg := ConnMessage{Type: "results"}
 	msg.Data, err = json.Marshal(data)
 	if err != nil {
-		log.Printf("RoomHost: %s", err)
-		h.Conn.Close()
+		h.Conn().Log().Error("Encode message failed", "err", err)
+		h.Conn().Close()
 		return
 	}
-	h.Conn.Write(&msg)
+	h.Conn().Write(&msg)
 }
 
 func (h *RoomHost) Complete(game *game.Game) {
 	var err error
-	data := &resultsMessage{}
-	for player, total := range game.Players {
-		data.Points = append(data.Points, resultPoints{Player: player, Total: total})
-	}
+	data := newResultsMessage(game, nil)
+	data.Funniest = game.Funniest()
 	msg := ConnMessage{Type: "complete"}
 	msg.Data, err = json.Marshal(data)
 	if err != nil {
-		log.Printf("RoomHost: %s", err)
-		h.Conn.Close()
+		h.Conn().Log().Error("Encode message failed", "err", err)
+		h.Conn().Close()
 		return
 	}
-	h.Conn.Write(&msg)
+	h.Conn().Write(&msg)
 }
 
 type roomMessage struct {
-	Code string
+	Code  string
+	Token string
+	Rules *game.Rules
 }
 
-func (h *RoomHost) Run(ctx context.Context, room *Room, detach func()) error {
+// SendCreated tells the host which room it is running and the rules it is
+// played by, and hands it the token needed to reclaim the room from a new
+// connection.
+func (h *RoomHost) SendCreated(code string, rules *game.Rules) error {
 	var err error
 	msg := ConnMessage{Type: "create"}
-	msg.Data, err = json.Marshal(roomMessage{Code: room.Code})
+	msg.Data, err = json.Marshal(roomMessage{Code: code, Token: h.Token, Rules: rules})
+	if err != nil {
+		return err
+	}
+	return h.Conn().Write(&msg)
+}
+
+type stateMessage struct {
+	Phase     game.Phase
+	Points    []resultPoints
+	Question  *game.Question `json:",omitempty"`
+	Deadline  time.Time
+	Seconds   int
+	Collected []game.Player   `json:",omitempty"`
+	Away      []game.Player   `json:",omitempty"`
+	Offsets   []resultOffsets `json:",omitempty"`
+	Audience  int
+	Funniest  []game.Player `json:",omitempty"`
+}
+
+// SendState sends everything needed to redraw the host screen for the
+// current phase of g.
+func (h *RoomHost) SendState(g *game.Game) error {
+	var err error
+	data := stateMessage{
+		Phase:    g.Phase(),
+		Deadline: g.Deadline(),
+		Seconds:  secondsUntil(g.Deadline()),
+		Audience: len(g.Audience),
+	}
+	results := newResultsMessage(g, g.Results())
+	data.Points = results.Points
+	for player := range g.Players {
+		if g.IsAway(player) {
+			data.Away = append(data.Away, player)
+		}
+	}
+	switch g.Phase() {
+	case game.PhaseAnswer:
+		data.Question = g.Current()
+		for _, answer := range data.Question.Answers {
+			if answer.Player != nil {
+				data.Collected = append(data.Collected, answer.Player)
+			}
+		}
+	case game.PhaseVote:
+		data.Question = g.Current()
+		for _, answer := range data.Question.Answers {
+			if data.Question.Final {
+				data.Collected = append(data.Collected, answer.SecondVotes...)
+			} else {
+				data.Collected = append(data.Collected, answer.Votes...)
+			}
+		}
+	case game.PhaseResults:
+		data.Question = g.Current()
+		data.Offsets = results.Offsets
+	case game.PhaseComplete:
+		data.Funniest = g.Funniest()
+	}
+	msg := ConnMessage{Type: "state"}
+	msg.Data, err = json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	return h.Conn().Write(&msg)
+}
+
+type audienceMessage struct {
+	Audience int
+}
+
+// SendAudience tells the host how many people are watching.
+func (h *RoomHost) SendAudience(audience int) error {
+	var err error
+	msg := ConnMessage{Type: "audience"}
+	msg.Data, err = json.Marshal(audienceMessage{Audience: audience})
+	if err != nil {
+		return err
+	}
+	return h.Conn().Write(&msg)
+}
+
+// SendMaintenance warns the host that the server is going down at deadline.
+func (h *RoomHost) SendMaintenance(deadline time.Time) error {
+	msg, err := newMaintenanceMessage(deadline)
 	if err != nil {
 		return err
 	}
-	if err := h.Conn.Write(&msg); err != nil {
+	return h.Conn().Write(msg)
+}
+
+// SendKicked tells the host that player was removed from the room, freeing
+// their place.
+func (h *RoomHost) SendKicked(player *RoomPlayer) error {
+	var err error
+	msg := ConnMessage{Type: "kicked"}
+	msg.Data, err = json.Marshal(joinedMessage{Player: player})
+	if err != nil {
 		return err
 	}
+	return h.Conn().Write(&msg)
+}
+
+type standingsMessage struct {
+	Standings []*Standing
+}
+
+// SendStandings sends the standings across every game played in the room.
+func (h *RoomHost) SendStandings(standings []*Standing) error {
+	var err error
+	msg := ConnMessage{Type: "standings"}
+	msg.Data, err = json.Marshal(standingsMessage{Standings: standings})
+	if err != nil {
+		return err
+	}
+	return h.Conn().Write(&msg)
+}
+
+type kickMessage struct {
+	// Player is the ID of the player or audience member to remove.
+	Player string
+	// Ban refuses their browser if they try to come back, see Room.Kick.
+	Ban bool
+}
+
+type rematchMessage struct {
+	// Carry keeps the standings from previous games.
+	Carry bool
+}
+
+func (h *RoomHost) Run(ctx context.Context, room *Room) error {
+	// Reads stay on the connection the host arrived on. A reclaim replaces
+	// h.conn and closes this one, ending the loop.
+	conn := h.Conn()
 	for {
 		var msg ConnMessage
-		if err := h.Conn.Read(&msg); err != nil {
+		if err := conn.Read(&msg); err != nil {
 			return err
 		}
 		switch msg.Type {
 		case "begin":
-			detach()
 			room.Begin()
 		case "next":
 			room.Next()
@@ -152,6 +348,24 @@ func (h *RoomHost) Run(ctx context.Context, room *Room, detach func()) error {
 			room.Vote()
 		case "stop":
 			room.Stop()
+		case "rematch":
+			var req rematchMessage
+			if len(msg.Data) > 0 {
+				if err := json.Unmarshal(msg.Data, &req); err != nil {
+					return err
+				}
+			}
+			if err := room.Rematch(req.Carry); err != nil {
+				conn.Log().Warn("Rematch refused", "err", err)
+			}
+		case "kick":
+			var req kickMessage
+			if err := json.Unmarshal(msg.Data, &req); err != nil {
+				return err
+			}
+			if err := room.Kick(req.Player, req.Ban); err != nil {
+				conn.Log().Warn("Kick refused", "err", err)
+			}
 		}
 		select {
 		case <-ctx.Done():
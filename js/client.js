@@ -6,20 +6,24 @@ $(function() {
       $waiting     = $('.waiting'),
       $question    = $('.question'),
       $answer_form = $('#answer-form'),
-      $answers     = $question.find('.answers');
+      $answers     = $question.find('.answers'),
+      $choice      = $question.find('.choice'),
+      $maintenance = $('.maintenance');
 
   function appendLog(msg) {
     console.log(msg);
   }
 
-  var conn, state = stateJoined;
+  // watching is set for the audience, who vote but do not like answers.
+  var conn, state = stateJoined, watching = false;
 
   function waiting() {
-    $waiting.show();
+    $waiting.show().text("Please wait.");
     $error.hide();
     $question.hide();
     $answer_form.hide();
     $answers.hide();
+    $choice.hide();
   }
 
   function stopWaiting() {
@@ -27,12 +31,39 @@ $(function() {
     $waiting.hide();
   }
 
+  // The session is kept so that a dropped connection or reloaded page can
+  // rejoin the room as the same player.
+  function saveSession(session) {
+    sessionStorage.setItem('session', JSON.stringify(session));
+  }
+
+  function loadSession() {
+    return JSON.parse(sessionStorage.getItem('session'));
+  }
+
+  function clearSession() {
+    sessionStorage.removeItem('session');
+  }
+
+  // A blocked player's token is kept by the browser so that the room can
+  // refuse them if they try to join again from it. Nothing stops them
+  // joining from elsewhere.
+  function bannedToken(code) {
+    var banned = JSON.parse(localStorage.getItem('banned'));
+    if ( banned && banned["Code"] === code.toUpperCase() ) {
+      return banned["Token"];
+    }
+    return "";
+  }
+
   function stateJoined(action, data) {
     switch(action) {
       case "ok":
+        saveSession(data["Data"]);
         waiting();
         return stateWaiting;
       case "error":
+        clearSession();
         $waiting.hide();
         $error.show().text(data["Data"]["Text"]);
         $join_form.show()
@@ -55,15 +86,37 @@ $(function() {
         // {"Type":"vote","Data":{"Text":"A phlebotomist extracts what from the human body?","Answers":["BLOOD"]}}
         stopWaiting();
         $question.show().find('h2').text(data["Data"]["Text"]);
-        $answers.show().html($.map(data["Data"]["Answers"], function(text){ return $('<button>').text(text).wrap('<li>'); }));
+        $answers.show().html($.map(data["Data"]["Answers"], function(text){
+          var $item = $('<li>').append($('<button class="vote">').text(text));
+          if ( !watching ) {
+            $item.append($('<button class="like">').text('\u2665').data('text', text));
+          }
+          return $item;
+        }));
         return stateVoting;
+      case "final":
+        // The final round asks for a first and then a second choice. A
+        // player returning part way through resumes at the second.
+        stateWaiting("vote", data);
+        $choice.show().text("Pick your first choice");
+        if ( data["Data"]["First"] ) {
+          $answers.find('.vote').filter(function () {
+            return $(this).text() === data["Data"]["First"];
+          }).addClass('chosen');
+          $choice.text("Pick your second choice");
+        }
+        return stateFinalVoting;
       case "results":
         waiting();
         break;
       case "complete":
-        stopWaiting();
-        $join_form.show();
-        return stateJoined;
+        // Stay in the room in case the host plays again.
+        waiting();
+        $waiting.text("Game over! Waiting for the host.");
+        break;
+      case "lobby":
+        waiting();
+        break;
       default:
         appendLog("stateWaiting: " + action + ": " + JSON.stringify(data));
     }
@@ -90,6 +143,11 @@ $(function() {
       case "ok":
         waiting();
         return stateWaiting;
+      case "liked":
+        $answers.find('.like').filter(function () {
+          return $(this).data('text') === data["Data"]["Text"];
+        }).addClass('liked');
+        break;
       case "error":
         $error.show().text(data["Data"]["Text"]);
         break;
@@ -100,29 +158,70 @@ $(function() {
     return stateVoting;
   }
 
-  $join_form.submit(function(event) {
-    event.preventDefault();
-    conn = new WebSocket($('body').data('url'));
+  function stateFinalVoting(action, data) {
+    switch(action) {
+      case "ok":
+        if ( $answers.find('.chosen').length === 0 ) {
+          $answers.find('.vote').filter(function () {
+            return $(this).text() === $choice.data('text');
+          }).addClass('chosen');
+          $choice.text("Pick your second choice");
+          break;
+        }
+        waiting();
+        return stateWaiting;
+      default:
+        // Likes and errors are handled as in an ordinary vote.
+        var next = stateVoting(action, data);
+        return next === stateVoting ? stateFinalVoting : next;
+    }
+    return stateFinalVoting;
+  }
 
+  function connect(message) {
+    var closing = false,
+        reason  = "Connection closed";
+    conn = new WebSocket($('body').data('url'));
+    state = stateJoined;
 
     conn.onopen = function(event) {
       $join_form.hide();
       $waiting.show();
-      conn.send(JSON.stringify({Type: 'join', Data: {
-        Name: $('input[name=name]').val(),
-        Code: $('input[name=code]').val()
-      }}))
+      conn.send(JSON.stringify(message));
     };
 
     conn.onmessage = function(event) {
       var data   = JSON.parse(event.data),
           action = data["Type"];
+      if ( action === "error" && state === stateJoined ) {
+        closing = true;
+      }
+      if ( action === "kicked" ) {
+        var session = loadSession();
+        if ( data["Data"]["Banned"] && session ) {
+          localStorage.setItem('banned', JSON.stringify(session));
+        }
+        closing = true;
+        reason = data["Data"]["Reason"];
+        clearSession();
+        return;
+      }
+      if ( action === "maintenance" ) {
+        // The server is restarting, the session rejoins once it is back.
+        $maintenance.show();
+        return;
+      }
       state = state(action, data);
     };
 
     conn.onclose = function(event) {
+      var session = loadSession();
+      if ( session && !closing ) {
+        setTimeout(rejoin, 1000);
+        return;
+      }
       stopWaiting();
-      $error.show().text("Connection closed");
+      $error.show().text(reason);
       $join_form.show();
       state = stateJoined;
     };
@@ -130,8 +229,41 @@ $(function() {
     conn.onerror = function(event) {
       appendLog("Error: " + event.data);
     };
+  }
+
+  function rejoin() {
+    var session = loadSession();
+    connect({Type: 'rejoin', Data: {
+      Code: session["Code"],
+      Token: session["Token"]
+    }});
+  }
+
+  $join_form.submit(function(event) {
+    event.preventDefault();
+    watching = false;
+    connect({Type: 'join', Data: {
+      Name: $('input[name=name]').val(),
+      Code: $('input[name=code]').val(),
+      Token: bannedToken($('input[name=code]').val())
+    }});
+  });
+
+  // The audience only vote for their favourite lie.
+  $join_form.find('.watch').click(function(event) {
+    event.preventDefault();
+    watching = true;
+    connect({Type: 'watch', Data: {
+      Name: $('input[name=name]').val(),
+      Code: $('input[name=code]').val(),
+      Token: bannedToken($('input[name=code]').val())
+    }});
   });
 
+  if ( loadSession() ) {
+    rejoin();
+  }
+
   $answer_form.submit(function (event) {
     event.preventDefault();
     conn.send(JSON.stringify({Type: 'answer', Data: {
@@ -140,9 +272,17 @@ $(function() {
     $('textarea[name=answer]').val('');
   });
 
-  $answers.click(function (event) {
+  $answers.on('click', '.vote', function (event) {
+    $choice.data('text', $(this).text());
     conn.send(JSON.stringify({Type: 'vote', Data: {
-      Text: event.target.innerText
+      Text: $(this).text()
+    }}));
+  });
+
+  // Liking an answer is separate from voting, any number may be liked.
+  $answers.on('click', '.like', function (event) {
+    conn.send(JSON.stringify({Type: 'like', Data: {
+      Text: $(this).data('text')
     }}));
   });
 });
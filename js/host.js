@@ -2,37 +2,44 @@
 
 $(function() {
   var $players         = $(".players"),
+      $setup           = $(".setup"),
+      $error           = $(".error"),
       $start           = $(".start"),
+      $rematch         = $(".rematch"),
       $question        = $(".question"),
+      $category        = $(".category"),
       $answers         = $(".answers"),
       $join            = $(".join"),
       $timer           = $(".timer"),
       $lobby           = $(".lobby"),
       $place_your_vote = $('.place-your-vote'),
       $scoreboard = $('.scoreboard'),
+      $standings  = $('.standings'),
+      $audience   = $('.audience'),
+      $favourite  = $('.favourite'),
+      $maintenance = $('.maintenance'),
       timer;
 
-  var Timer = function (el) {
-    var time_remaining = 30,
+  // Timer only displays the countdown, the server closes each phase when its
+  // deadline passes.
+  var Timer = function (el, seconds_remaining) {
+    var time_remaining,
         seconds        = el.find('.seconds'),
         interval;
 
-    seconds.text(time_remaining);
-    interval = setInterval(showTime.bind(this), 1000);
-
     function showTime() {
+      if ( time_remaining > 0 ) {
+        time_remaining--;
+      }
+      seconds.text(time_remaining);
       if ( time_remaining === 0 ) {
         this.stop();
-        conn.send(JSON.stringify({type: "stop"}));
-      } else {
-        time_remaining--;
-        seconds.text(time_remaining);
       }
     };
 
-    this.reset = function () {
+    this.reset = function (seconds_remaining) {
       this.stop();
-      time_remaining = 30;
+      time_remaining = seconds_remaining;
       seconds.text(time_remaining);
       interval = setInterval(showTime.bind(this), 1000);
     };
@@ -40,18 +47,208 @@ $(function() {
     this.stop = function () {
       clearInterval(interval);
     };
+
+    this.reset(seconds_remaining);
+  }
+
+  // The session lets a reloaded page reclaim its room instead of creating a
+  // new one.
+  function saveSession(session) {
+    sessionStorage.setItem('session', JSON.stringify(session));
+  }
+
+  function loadSession() {
+    return JSON.parse(sessionStorage.getItem('session'));
+  }
+
+  function clearSession() {
+    sessionStorage.removeItem('session');
+  }
+
+  var conn, state, create;
+
+  function connect() {
+    conn = new WebSocket($('body').data('url'));
+    state = lobby;
+
+    conn.onopen = function(event) {
+      var session = loadSession();
+      console.log("Connection opened");
+      if ( session ) {
+        conn.send(JSON.stringify({type: "reclaim", data: session}));
+      } else {
+        conn.send(JSON.stringify({type: "create", data: create}));
+      }
+    };
+
+    conn.onmessage = function(event) {
+      var res = JSON.parse(event.data);
+      if ( res["Type"] === "maintenance" ) {
+        // The room is kept through the restart and reclaimed afterwards.
+        $maintenance.show();
+        return;
+      }
+      if ( res["Type"] === "kicked" ) {
+        freeSlot(playerSlot(res["Data"]["Player"]));
+        return;
+      }
+      state = state(event);
+    };
+
+    conn.onclose = function(event) {
+      console.log("Connection closed");
+      if ( loadSession() ) {
+        setTimeout(connect, 1000);
+      }
+    };
+
+    conn.onerror = function(event) {
+      console.log("Error: " + event.data);
+    };
   }
 
-  var conn = new WebSocket($('body').data('url'));
+  var started = false;
 
-  conn.onopen = function(event) {
-    console.log("Connection opened");
-    conn.send(JSON.stringify({type: "create"}));
-  };
+  function playerSlot(player) {
+    return $players.find('li').filter(function () {
+      return $(this).data('id') === player["ID"];
+    });
+  }
+
+  function playerJoined(player) {
+    var $slot = playerSlot(player);
+    if ( $slot.length === 0 ) {
+      $slot = $players.find('.blank').first().data('id', player["ID"]);
+    }
+    $slot.text(player["Name"]).removeClass('blank away');
+  }
+
+  // playerLeft frees the slot of a player who leaves before the game starts,
+  // after that the player keeps their slot until they return.
+  function playerLeft(player) {
+    var $slot = playerSlot(player);
+    if ( started ) {
+      $slot.addClass('away');
+    } else {
+      freeSlot($slot);
+    }
+  }
 
-  var state = lobby;
-  conn.onmessage = function(event) {
-    state = state(event);
+  function freeSlot($slot) {
+    $slot.removeData('id').text('login to play!').removeClass('away').addClass('blank');
+    $players.append($slot);
+  }
+
+  // Clicking a player offers to remove them, for an offensive name or lies.
+  $players.on('click', 'li', function () {
+    var id   = $(this).data('id'),
+        name = $(this).text();
+    if ( !id || !window.confirm('Remove ' + name + ' from the room?') ) {
+      return;
+    }
+    conn.send(JSON.stringify({type: "kick", data: {
+      Player: id,
+      Ban: window.confirm('Block ' + name + "'s browser from rejoining? " +
+                          'They could still join from another browser or a private window.')
+    }}));
+  });
+
+  function showPlayers(points, away) {
+    $players.find('li').removeData('id').removeClass('away').addClass('blank').text('login to play!');
+    $.each(points, function (i, score) {
+      playerJoined(score["Player"]);
+    });
+    $.each(away || [], function (i, player) {
+      playerSlot(player).addClass('away');
+    });
+  }
+
+  function showAudience(audience) {
+    $audience.toggle(audience > 0).find('.count').text(audience);
+  }
+
+  function showLobby() {
+    $('.game-title').text('TVGame');
+    $rematch.hide();
+    $scoreboard.hide();
+    $standings.hide();
+    $question.hide();
+    $category.hide();
+    $answers.hide();
+    $timer.hide();
+    $start.show();
+    $join.show();
+  }
+
+  function showQuestion(data) {
+    started = true;
+    $start.hide();
+    $scoreboard.hide();
+    $join.hide();
+    $place_your_vote.hide();
+    $answers.hide();
+    $timer.show();
+    $favourite.hide();
+    $question.show().text(data["Question"]["Text"]);
+    var about = $.grep([
+      data["Question"]["Category"],
+      data["Question"]["Difficulty"],
+      data["Question"]["Kind"] === "number" && 'Closest guess wins'
+    ], Boolean);
+    $category.toggle(about.length > 0).text(about.join(' · '));
+    if ( timer ) {
+      timer.reset(data["Seconds"]);
+    } else {
+      timer = new Timer($timer, data["Seconds"]);
+    }
+  }
+
+  function showVote(data) {
+    var answers = $.map(data["Question"]["Answers"], function (answer) {
+      return '<h2>' + answer["Text"] + '</h2>';
+    });
+    showQuestion(data);
+    $answers.html(answers.join('')).show();
+    $place_your_vote.show().text(data["Question"]["Final"] ? 'Final round! Pick your first and second choice' : 'Place your vote');
+  }
+
+  function showScores(data) {
+    if ( timer ) {
+      timer.stop();
+    }
+    $rematch.hide();
+    $start.hide();
+    $join.hide();
+    $place_your_vote.hide();
+    $timer.hide();
+    $question.hide();
+    $category.hide();
+    $answers.hide();
+    var scores = $.map(data["Points"].sort(function(a, b) { return b["Total"] - a["Total"]; }), function (score) {
+      return '<tr><td>' + score["Player"]["Name"] + '</td><td>' + score["Total"] + '</td><td>' + score["Likes"] + '</td></tr>';
+    });
+    $scoreboard.show().find('tbody').html(scores.join(''));
+    showFavourite(data["Offsets"]);
+  }
+
+  function showFunniest(funniest) {
+    if ( funniest && funniest.length > 0 ) {
+      $favourite.show().text('Funniest: ' + $.map(funniest, function (player) {
+        return player["Name"];
+      }).join(', '));
+    }
+  }
+
+  function showFavourite(offsets) {
+    var names = [];
+    $.each(offsets || [], function (i, offset) {
+      $.each(offset["Offsets"], function (j, result) {
+        if ( result["Audience"] ) {
+          names.push(result["Player"]["Name"]);
+        }
+      });
+    });
+    $favourite.toggle(names.length > 0).text('Audience favourite: ' + names.join(', '));
   }
 
   function voteCollection(event) {
@@ -60,6 +257,9 @@ $(function() {
         action = res["Type"];
 
     switch (action) {
+    case "left":
+      playerLeft(data["Player"]);
+      // fall through
     case "collected":
       // {"Type":"collected","Data":{"Player":{"ID":"948cce4fae","Name":"ff85"},"Complete":true}}
       if ( data["Complete"] ) {
@@ -84,6 +284,9 @@ $(function() {
         action = res["Type"];
 
     switch (action) {
+    case "left":
+      playerLeft(data["Player"]);
+      // fall through
     case "collected":
       // {"Type":"collected","Data":{"Player":{"ID":"948cce4fae","Name":"ff85"},"Complete":true}}
       if ( data["Complete"] ) {
@@ -105,47 +308,88 @@ $(function() {
 
     switch (action) {
     case "create":
-      $lobby.append(data["Code"]);
+      saveSession({Code: data["Code"], Token: data["Token"]});
+      $lobby.text(data["Code"]);
+      $error.hide();
+      $setup.hide();
+      if ( !started ) {
+        $start.show();
+        $join.show();
+      }
+      break;
+    case "error":
+      // The room could not be created or reclaimed, start over.
+      console.log("Error: " + data["Text"]);
+      clearSession();
+      $error.show().text(data["Text"]);
+      $setup.show();
+      break;
+    case "state":
+      started = data["Phase"] !== "lobby";
+      showPlayers(data["Points"], data["Away"]);
+      showAudience(data["Audience"]);
+      switch (data["Phase"]) {
+      case "lobby":
+        showLobby();
+        break;
+      case "answer":
+        showQuestion(data);
+        return answerCollection;
+      case "vote":
+        showVote(data);
+        return voteCollection;
+      case "results":
+        showScores(data);
+        setTimeout(function () { conn.send(JSON.stringify({type: "next"})) }, 5000);
+        break;
+      case "complete":
+        showScores(data);
+        showFunniest(data["Funniest"]);
+        $('.game-title').text('Someone is the winner!');
+        $rematch.show();
+        break;
+      }
       break;
     case "joined":
-      $players.find('.blank').first().text(data["Player"]["Name"]).removeClass('blank');
+      playerJoined(data["Player"]);
+      break;
+    case "audience":
+      showAudience(data["Audience"]);
+      break;
+    case "left":
+      playerLeft(data["Player"]);
       break;
     case "question":
       // {"Type":"question","Data":{"Question":{"Text":"In which year were premium bonds first issued in Britain?","Multiplier":1,"Answers":[{"Correct":true,"Text":"1956","Player":null,"Votes":null}]}}}
-      $start.hide();
-      $scoreboard.hide();
-      $join.hide();
-      $place_your_vote.hide();
-      $timer.show();
-      $question.show().text(data["Question"]["Text"]);
-      timer = new Timer($timer);
+      showQuestion(data);
       return answerCollection;
     case "vote":
-      var question_text = data["Question"]["Text"];
-      var answers = $.map(data["Question"]["Answers"], function (answer) {
-        return '<h2>' + answer["Text"] + '</h2>';
-      });
-      $answers.html(answers.join('')).show();
-      $place_your_vote.show();
-      timer.reset();
       // {"Type":"vote","Data":{"Question":{"Text":"In the city of Manchester (England) the Irk and Medlock join which river?","Multiplier":1,"Answers":[{"Correct":true,"Text":"IRWELL","Player":null,"Votes":null},{"Correct":false,"Text":"FOO","Player":{"ID":"04cdd7b5ca","Name":"25bb"},"Votes":null}]}}}
+      showVote(data);
       return voteCollection;
     case "results":
       console.log('received scores');
-      $place_your_vote.hide();
-      $timer.hide();
-      $question.hide();
-      $answers.hide();
-      var scores = $.map(data["Points"].sort(function(a, b) { return b["Total"] - a["Total"]; }), function (score) {
-        return '<tr><td>' + score["Player"]["Name"] + '</td><td>' + score["Total"] + '</td></tr>';
-      });
-      $scoreboard.show().find('tbody').html(scores.join(''));
+      showScores(data);
       setTimeout(function () { conn.send(JSON.stringify({type: "next"})) }, 5000);
       break;
       // {"Type":"results","Data":{"Points":[{"Player":{"ID":"XJWKFEUYLX","Name":"ALSAQ"},"Total":1500}],"Offsets":[{"Answer":{"Correct":true,"Text":"EGYPT","Player":null,"Votes":[{"ID":"XJWKFEUYLX","Name":"ALSAQ"}]},"Offsets":[{"Player":{"ID":"XJWKFEUYLX","Name":"ALSAQ"},"Offset":1500}]}]}}
+    case "standings":
+      // Only worth showing once more than one game has been played.
+      if ( $.grep(data["Standings"], function (s) { return s["Games"] > 1; }).length > 0 ) {
+        $standings.show().find('tbody').html($.map(data["Standings"], function (standing) {
+          return $('<tr>').append(
+            $('<td>').text(standing["Player"]["Name"]),
+            $('<td>').text(standing["Total"]),
+            $('<td>').text(standing["Wins"])
+          );
+        }));
+      }
+      break;
     case "complete":
       console.log('complete');
+      showFunniest(data["Funniest"]);
       $('.game-title').text('Someone is the winner!');
+      $rematch.show();
       break;
     default:
       console.log("Uncaught message from lobby: " + event.data);
@@ -153,16 +397,41 @@ $(function() {
     return lobby;
   }
 
-  conn.onclose = function(event) {
-    console.log("Connection closed");
-  };
+  $setup.submit(function(event) {
+    event.preventDefault();
+    create = {
+      Preset: $setup.find('select[name=preset]').val(),
+      Packs: $setup.find('input[name=pack]:checked').map(function () {
+        return this.value;
+      }).get()
+    };
+    // No packs at all means every pack, keeping the message short.
+    if ( $setup.find('input[name=pack]:not(:checked)').length === 0 ) {
+      create.Packs = [];
+    }
+    var moderation = $setup.find('select[name=moderation]').val();
+    if (moderation !== '') {
+      create.Rules = {Moderation: parseInt(moderation, 10)};
+    }
+    $setup.hide();
+    connect();
+  });
 
-  conn.onerror = function(event) {
-    console.log("Error: " + event.data);
-  };
+  $rematch.submit(function(event) {
+    event.preventDefault();
+    conn.send(JSON.stringify({type: "rematch", data: {
+      Carry: $rematch.find('input[name=carry]').is(':checked')
+    }}));
+  });
 
-  $('form').submit(function(event) {
+  $start.submit(function(event) {
     event.preventDefault();
     conn.send(JSON.stringify({type: "begin"}));
   });
+
+  if ( loadSession() ) {
+    connect();
+  } else {
+    $setup.show();
+  }
 });
@@ -1,19 +1,26 @@
 package main
 
 import (
+	"context"
 	"crypto/tls"
 	"flag"
 	"html/template"
 	"log"
+	"log/slog"
 	"math/rand"
 	"net/http"
 	_ "net/http/pprof"
 	"net/url"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 	"time"
 
 	"github.com/gorilla/websocket"
 	"github.com/proglottis/tvgame/game"
+	"github.com/proglottis/tvgame/store"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"golang.org/x/crypto/acme/autocert"
 )
 
@@ -25,9 +32,9 @@ var (
 func withLog(fn http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
-		log.Printf("Started %s %s", r.Method, r.URL.Path)
+		slog.Debug("Started request", "method", r.Method, "path", r.URL.Path)
 		fn(w, r)
-		log.Printf("Completed %s %s in %v", r.Method, r.URL.Path, time.Since(start))
+		slog.Info("Completed request", "method", r.Method, "path", r.URL.Path, "duration", time.Since(start))
 	}
 }
 
@@ -44,30 +51,98 @@ func websocketURL(r *http.Request) template.URL {
 	return template.URL(ws.String())
 }
 
+// joinAddress is where players are told to join, the public URL if one is
+// configured or else the host the page was loaded from.
+func joinAddress(publicURL string, r *http.Request) string {
+	if publicURL == "" {
+		return r.Host
+	}
+	u, err := url.Parse(publicURL)
+	if err != nil {
+		return publicURL
+	}
+	return strings.TrimSuffix(u.Host+u.Path, "/")
+}
+
+// fatal logs err and exits.
+func fatal(msg string, err error) {
+	slog.Error(msg, "err", err)
+	os.Exit(1)
+}
+
+type hostPage struct {
+	URL     template.URL
+	Join    string
+	Presets []string
+	Packs   []PackInfo
+}
+
 func main() {
 	rand.Seed(time.Now().UTC().UnixNano())
-	flag.Parse()
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
+	config, dump, err := ParseConfig(os.Args[0], os.Args[1:], os.Getenv)
+	if err == flag.ErrHelp {
+		os.Exit(2)
+	}
+	if err != nil {
+		log.Fatalf("Config: %s", err)
 	}
-	portTLS := os.Getenv("PORT_TLS")
-	if portTLS == "" {
-		portTLS = "8081"
+	if dump {
+		if err := config.Dump(os.Stdout); err != nil {
+			log.Fatalf("Config: %s", err)
+		}
+		return
 	}
-	csv, err := os.Open(flag.Arg(0))
+	slog.SetDefault(config.Logger(os.Stderr))
+	packs, err := NewPackLibrary(config.Packs)
 	if err != nil {
-		log.Fatalf("Load CSV: %s", err)
+		fatal("Load questions failed", err)
 	}
-	repo, err := game.NewQuestionRepo(csv)
+	go packs.Watch(context.Background(), config.WatchInterval())
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			if err := packs.Reload(); err != nil {
+				slog.Error("Reload questions failed", "err", err)
+			}
+		}
+	}()
+	db, err := store.OpenBolt(config.DBPath)
 	if err != nil {
-		log.Fatal("Parse CSV: %s", err)
+		fatal("Open store failed", err)
 	}
-	server := NewServer(repo)
+	defer db.Close()
+	server := NewServer(packs)
+	server.Store = db
+	server.HostGrace = config.HostGrace()
+	server.MaxRooms = config.MaxRooms
+	server.Moderator = game.DefaultWordList()
+	if config.WordList != "" {
+		if server.Moderator, err = game.LoadWordList(config.WordList); err != nil {
+			fatal("Load word list failed", err)
+		}
+	}
+	snapshots := config.SnapshotDir
+	if err := os.MkdirAll(snapshots, 0700); err != nil {
+		fatal("Create snapshot directory failed", err)
+	}
+	if err := server.LoadSnapshots(snapshots); err != nil {
+		fatal("Restore snapshots failed", err)
+	}
+	snapshotCtx, stopSnapshots := context.WithCancel(context.Background())
+	snapshotsDone := make(chan struct{})
+	go func() {
+		server.WatchSnapshots(snapshotCtx, snapshots, config.WatchInterval())
+		close(snapshotsDone)
+	}()
 	upgrader := websocket.Upgrader{
 		ReadBufferSize:  1024,
 		WriteBufferSize: 1024,
 	}
+	http.Handle("/metrics", promhttp.Handler())
+	if config.AdminToken != "" {
+		http.Handle("/admin/", withLog(server.AdminHandler(config.AdminToken).ServeHTTP))
+	}
 	http.Handle("/js/", http.StripPrefix("/js/", http.FileServer(http.Dir("js"))))
 	http.Handle("/css/", http.StripPrefix("/css/", http.FileServer(http.Dir("css"))))
 	http.HandleFunc("/", withLog(func(w http.ResponseWriter, r *http.Request) {
@@ -93,41 +168,82 @@ func main() {
 			return
 		}
 		w.Header().Set("Content-Type", "text/html; charset=utf-8")
-		host.Execute(w, websocketURL(r))
+		host.Execute(w, hostPage{
+			URL:     websocketURL(r),
+			Join:    joinAddress(config.PublicURL, r),
+			Presets: game.PresetNames(),
+			Packs:   server.Packs.List(),
+		})
 	}))
 
 	http.HandleFunc("/ws", withLog(func(w http.ResponseWriter, r *http.Request) {
 		conn, err := upgrader.Upgrade(w, r, nil)
 		if err != nil {
-			log.Printf("Upgrade: %s", err)
+			slog.Warn("Upgrade failed", "err", err)
 			return
 		}
-		if err := server.Handle(r.Context(), NewConn(r.Context(), conn)); err != nil {
-			log.Printf("Server: %s", err)
+		c := NewConn(r.Context(), conn)
+		if err := server.Handle(r.Context(), c); err != nil {
+			c.Log().Info("Connection ended", "err", err)
 			return
 		}
 	}))
 
-	go func() {
-		addr := ":" + portTLS
-		log.Printf("Starting TLS on %s", addr)
+	var httpsServer *http.Server
+	switch config.TLS.Mode {
+	case TLSAutocert:
 		m := autocert.Manager{
 			Prompt:     autocert.AcceptTOS,
-			Cache:      autocert.DirCache("cache"),
-			HostPolicy: autocert.HostWhitelist("tv.nothing.co.nz"),
+			Cache:      autocert.DirCache(config.TLS.CacheDir),
+			HostPolicy: autocert.HostWhitelist(config.TLS.Domains...),
 		}
-		s := &http.Server{
-			Addr:      addr,
+		httpsServer = &http.Server{
+			Addr:      config.TLS.Listen,
 			TLSConfig: &tls.Config{GetCertificate: m.GetCertificate},
 		}
-		if err := s.ListenAndServeTLS("", ""); err != nil {
-			log.Fatal("ListenAndServeTLS:", err)
+	case TLSStatic:
+		httpsServer = &http.Server{Addr: config.TLS.Listen}
+	}
+	httpServer := &http.Server{Addr: config.Listen}
+	if httpsServer != nil {
+		go func() {
+			slog.Info("Starting TLS", "addr", httpsServer.Addr, "mode", config.TLS.Mode)
+			// The static files are ignored when autocert supplies the
+			// certificates.
+			if err := httpsServer.ListenAndServeTLS(config.TLS.CertFile, config.TLS.KeyFile); err != http.ErrServerClosed {
+				fatal("ListenAndServeTLS failed", err)
+			}
+		}()
+	}
+
+	go func() {
+		slog.Info("Starting", "addr", httpServer.Addr)
+		if err := httpServer.ListenAndServe(); err != http.ErrServerClosed {
+			fatal("ListenAndServe failed", err)
 		}
 	}()
 
-	addr := ":" + port
-	log.Printf("Starting on %s", addr)
-	if err := http.ListenAndServe(addr, nil); err != nil {
-		log.Fatal("ListenAndServe:", err)
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGTERM, os.Interrupt)
+	<-stop
+	slog.Info("Shutting down, draining rooms", "timeout", config.DrainTimeout())
+	ctx, cancel := context.WithTimeout(context.Background(), config.DrainTimeout())
+	defer cancel()
+	if err := server.Drain(ctx); err != nil {
+		slog.Warn("Drain incomplete", "err", err)
+	}
+	// Snapshot the rooms before closing them, so they can be restored when
+	// the server comes back.
+	stopSnapshots()
+	<-snapshotsDone
+	if err := server.SaveSnapshots(snapshots); err != nil {
+		slog.Error("Snapshot failed", "err", err)
+	}
+	server.Close()
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	httpServer.Shutdown(ctx)
+	if httpsServer != nil {
+		httpsServer.Shutdown(ctx)
 	}
 }
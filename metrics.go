@@ -0,0 +1,109 @@
+package main
+
+import (
+	"errors"
+	"time"
+
+	"github.com/proglottis/tvgame/game"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	roomsGauge = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "tvgame_rooms",
+		Help: "Rooms open on the server.",
+	})
+	connectedGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "tvgame_connected",
+		Help: "Connections by role: host, player or audience.",
+	}, []string{"role"})
+	messagesCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "tvgame_messages_total",
+		Help: "Messages read from and written to connections, by type.",
+	}, []string{"direction", "type"})
+	sendQueueHistogram = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "tvgame_send_queue_depth",
+		Help:    "Messages waiting to be written to a connection as another is queued.",
+		Buckets: []float64{0, 1, 5, 10, 50, 100, 250, 500},
+	})
+	phaseHistogram = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "tvgame_phase_duration_seconds",
+		Help:    "How long game phases last, by phase.",
+		Buckets: []float64{1, 5, 10, 20, 30, 45, 60, 120, 300, 600},
+	}, []string{"phase"})
+	gamesCounter = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "tvgame_games_completed_total",
+		Help: "Games played through to the end.",
+	})
+	joinFailuresCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "tvgame_join_failures_total",
+		Help: "Failed attempts to join, watch or rejoin a room, by reason.",
+	}, []string{"reason"})
+)
+
+// readTypes are the message types clients send. Anything else is counted as
+// unknown so that clients cannot create metrics at will.
+var readTypes = map[string]bool{
+	"create":  true,
+	"join":    true,
+	"watch":   true,
+	"rejoin":  true,
+	"reclaim": true,
+	"begin":   true,
+	"next":    true,
+	"vote":    true,
+	"stop":    true,
+	"rematch": true,
+	"answer":  true,
+	"like":    true,
+	"kick":    true,
+}
+
+func countRead(typ string) {
+	if !readTypes[typ] {
+		typ = "unknown"
+	}
+	messagesCounter.WithLabelValues("in", typ).Inc()
+}
+
+func countWrite(typ string) {
+	messagesCounter.WithLabelValues("out", typ).Inc()
+}
+
+func observePhase(phase game.Phase, d time.Duration) {
+	phaseHistogram.WithLabelValues(phase.String()).Observe(d.Seconds())
+}
+
+// countJoinFailure records why joining a room failed.
+func countJoinFailure(err error) {
+	reason := "other"
+	switch {
+	case errors.Is(err, ErrNoRoom):
+		reason = "no_room"
+	case errors.Is(err, ErrNameShort) || errors.Is(err, ErrNameLong):
+		reason = "bad_name"
+	case errors.Is(err, ErrNameTaken):
+		reason = "name_taken"
+	case errors.Is(err, game.ErrProfane):
+		reason = "profane_name"
+	case errors.Is(err, ErrNoPlayer):
+		reason = "bad_token"
+	case errors.Is(err, ErrBanned):
+		reason = "banned"
+	case errors.Is(err, game.ErrRoomFull):
+		reason = "room_full"
+	case errors.Is(err, game.ErrStarted):
+		reason = "started"
+	case errors.Is(err, game.ErrNoAudience):
+		reason = "audience_full"
+	}
+	joinFailuresCounter.WithLabelValues(reason).Inc()
+}
+
+// connected counts a connection in role until the returned func is called.
+func connected(role string) func() {
+	gauge := connectedGauge.WithLabelValues(role)
+	gauge.Inc()
+	return gauge.Dec
+}
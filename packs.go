@@ -0,0 +1,186 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/proglottis/tvgame/game"
+)
+
+type PackInfo struct {
+	Name        string
+	Title       string
+	Description string
+	Questions   int
+}
+
+// PackLibrary holds the question packs loaded from a set of pack files and
+// directories. Reloading swaps in a whole new set of packs, so rooms keep
+// whatever questions they have already drawn.
+type PackLibrary struct {
+	paths []string
+
+	mu          sync.RWMutex
+	packs       map[string]*game.QuestionRepo
+	fingerprint string
+}
+
+func NewPackLibrary(paths []string) (*PackLibrary, error) {
+	l := &PackLibrary{paths: paths}
+	if err := l.Reload(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// Packs returns the current packs keyed by name. The packs are shared between
+// rooms and must not be modified.
+func (l *PackLibrary) Packs() map[string]*game.QuestionRepo {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.packs
+}
+
+// List describes the current packs, ordered by name.
+func (l *PackLibrary) List() []PackInfo {
+	var list []PackInfo
+	for name, repo := range l.Packs() {
+		list = append(list, PackInfo{
+			Name:        name,
+			Title:       repo.Title,
+			Description: repo.Description,
+			Questions:   repo.Len(),
+		})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// Reload parses every pack again and, only if they are all valid, replaces
+// the current packs with them.
+func (l *PackLibrary) Reload() error {
+	fingerprint, err := l.stat()
+	if err != nil {
+		return err
+	}
+	packs, err := loadPacks(l.paths)
+	if err != nil {
+		return err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.packs = packs
+	l.fingerprint = fingerprint
+	slog.Info("Loaded packs", "packs", len(packs))
+	return nil
+}
+
+// Watch reloads the packs whenever the files change, checking every interval
+// until ctx is done.
+func (l *PackLibrary) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			fingerprint, err := l.stat()
+			if err != nil {
+				slog.Error("Check packs failed", "err", err)
+				continue
+			}
+			l.mu.RLock()
+			changed := fingerprint != l.fingerprint
+			l.mu.RUnlock()
+			if !changed {
+				continue
+			}
+			if err := l.Reload(); err != nil {
+				slog.Error("Reload packs failed, keeping previous packs", "err", err)
+				// Don't retry until the files change again.
+				l.mu.Lock()
+				l.fingerprint = fingerprint
+				l.mu.Unlock()
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// stat summarises the names, sizes and modification times of the pack files
+// so that changes can be detected without parsing them.
+func (l *PackLibrary) stat() (string, error) {
+	var b strings.Builder
+	for _, path := range l.paths {
+		files, err := packFiles(path)
+		if err != nil {
+			return "", err
+		}
+		for _, file := range files {
+			info, err := os.Stat(file)
+			if err != nil {
+				return "", err
+			}
+			fmt.Fprintf(&b, "%s %d %d\n", file, info.Size(), info.ModTime().UnixNano())
+		}
+	}
+	return b.String(), nil
+}
+
+// packFiles lists the pack files at path, which may be a pack file or a
+// directory of packs.
+func packFiles(path string) ([]string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return []string{path}, nil
+	}
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, entry := range entries {
+		ext := strings.ToLower(filepath.Ext(entry.Name()))
+		if !entry.IsDir() && (ext == ".csv" || ext == ".json") {
+			files = append(files, filepath.Join(path, entry.Name()))
+		}
+	}
+	return files, nil
+}
+
+// loadPacks loads the question packs at each path.
+func loadPacks(paths []string) (map[string]*game.QuestionRepo, error) {
+	packs := make(map[string]*game.QuestionRepo)
+	for _, path := range paths {
+		files, err := packFiles(path)
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range files {
+			name := game.PackName(file)
+			if _, ok := packs[name]; ok {
+				return nil, fmt.Errorf("Duplicate pack: %s", name)
+			}
+			repo, err := game.OpenQuestionRepo(file)
+			if err != nil {
+				return nil, err
+			}
+			packs[name] = repo
+		}
+	}
+	if len(packs) < 1 {
+		return nil, errors.New("No question packs found")
+	}
+	return packs, nil
+}
@@ -3,50 +3,123 @@ package main
 import (
 	"context"
 	"encoding/json"
-	"log"
+	"sync"
+	"time"
 
 	"github.com/proglottis/tvgame/game"
 )
 
 type RoomPlayer struct {
-	ID   string
-	Name string
-	Conn *Conn `json:"-"`
+	ID    string
+	Name  string
+	Token string `json:"-"`
+
+	mu   sync.Mutex
+	conn *Conn
+}
+
+func NewRoomPlayer(name string, conn *Conn) *RoomPlayer {
+	return &RoomPlayer{
+		ID:    generateCode(10),
+		Name:  game.CleanText(name),
+		Token: generateToken(),
+		conn:  conn,
+	}
+}
+
+// Conn returns the connection the player is currently using.
+func (p *RoomPlayer) Conn() *Conn {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.conn
+}
+
+// setConn binds the player to a new connection, closing the old one.
+func (p *RoomPlayer) setConn(conn *Conn) {
+	p.mu.Lock()
+	old := p.conn
+	p.conn = conn
+	p.mu.Unlock()
+	if old != nil && old != conn {
+		old.Close()
+	}
+}
+
+func (p *RoomPlayer) write(msg *ConnMessage) {
+	p.Conn().Write(msg)
 }
 
 type errorMessage struct {
 	Text string
 }
 
-func (p *RoomPlayer) SendError(text string) {
+func sendError(conn *Conn, text string) {
 	var err error
 	msg := ConnMessage{Type: "error"}
 	msg.Data, err = json.Marshal(errorMessage{Text: text})
 	if err != nil {
-		log.Printf("RoomPlayer: %s", err)
+		conn.Log().Error("Encode message failed", "err", err)
 		return
 	}
-	p.Conn.Write(&msg)
+	conn.Write(&msg)
+}
+
+func (p *RoomPlayer) SendError(text string) {
+	sendError(p.Conn(), text)
 }
 
 func (p *RoomPlayer) SendAck() {
 	msg := ConnMessage{Type: "ok"}
-	p.Conn.Write(&msg)
+	p.write(&msg)
+}
+
+type joinAckMessage struct {
+	ID    string
+	Code  string
+	Token string
+}
+
+// SendJoined acknowledges a join or rejoin, handing the player the token they
+// need to resume their session on a new connection.
+func (p *RoomPlayer) SendJoined(code string) {
+	var err error
+	msg := ConnMessage{Type: "ok"}
+	msg.Data, err = json.Marshal(joinAckMessage{ID: p.ID, Code: code, Token: p.Token})
+	if err != nil {
+		p.Conn().Log().Error("Encode message failed", "err", err)
+		return
+	}
+	p.write(&msg)
 }
 
 type requestAnswerMessage struct {
-	Text string
+	Text     string
+	Deadline time.Time
+	Seconds  int
 }
 
-func (p *RoomPlayer) RequestAnswer(text string) {
+func (p *RoomPlayer) RequestAnswer(text string, deadline time.Time) {
 	var err error
 	msg := ConnMessage{Type: "answer"}
-	msg.Data, err = json.Marshal(requestAnswerMessage{Text: text})
+	msg.Data, err = json.Marshal(requestAnswerMessage{Text: text, Deadline: deadline, Seconds: secondsUntil(deadline)})
 	if err != nil {
-		log.Printf("RoomPlayer: %s", err)
+		p.Conn().Log().Error("Encode message failed", "err", err)
 		return
 	}
-	p.Conn.Write(&msg)
+	p.write(&msg)
+}
+
+// SendLiked confirms a like. It is kept apart from SendAck so that liking an
+// answer does not end the player's turn to vote.
+func (p *RoomPlayer) SendLiked(text string) {
+	var err error
+	msg := ConnMessage{Type: "liked"}
+	msg.Data, err = json.Marshal(playerText{Text: game.CleanText(text)})
+	if err != nil {
+		p.Conn().Log().Error("Encode message failed", "err", err)
+		return
+	}
+	p.write(&msg)
 }
 
 type playerText struct {
@@ -54,20 +127,32 @@ type playerText struct {
 }
 
 func (p *RoomPlayer) Run(ctx context.Context, room *Room) error {
-	defer p.Conn.Close()
+	// Reads stay on the connection the player arrived on. A rejoin replaces
+	// p.conn and closes this one, ending the loop.
+	conn := p.Conn()
+	defer conn.Close()
 	for {
 		var msg ConnMessage
-		if err := p.Conn.Read(&msg); err != nil {
+		if err := conn.Read(&msg); err != nil {
 			return err
 		}
 		var text playerText
 		if err := json.Unmarshal(msg.Data, &text); err != nil {
 			return err
 		}
-		if err := room.Collect(p, text.Text); err != nil {
-			p.SendError(err.Error())
-		} else {
-			p.SendAck()
+		switch msg.Type {
+		case "like":
+			if err := room.Like(p, text.Text); err != nil {
+				p.SendError(err.Error())
+			} else {
+				p.SendLiked(text.Text)
+			}
+		default:
+			if err := room.Collect(p, text.Text); err != nil {
+				p.SendError(err.Error())
+			} else {
+				p.SendAck()
+			}
 		}
 		select {
 		case <-ctx.Done():
@@ -80,23 +165,90 @@ func (p *RoomPlayer) Run(ctx context.Context, room *Room) error {
 type requestVoteMessage struct {
 	Text    string
 	Answers []string
+	// First is the first choice already made in the final round, if any.
+	First    string `json:",omitempty"`
+	Deadline time.Time
+	Seconds  int
 }
 
-func (p *RoomPlayer) RequestVote(text string, answers []string) {
+func (p *RoomPlayer) RequestVote(text string, answers []string, deadline time.Time) {
 	var err error
 	msg := ConnMessage{Type: "vote"}
-	msg.Data, err = json.Marshal(requestVoteMessage{Text: text, Answers: answers})
+	msg.Data, err = json.Marshal(requestVoteMessage{Text: text, Answers: answers, Deadline: deadline, Seconds: secondsUntil(deadline)})
+	if err != nil {
+		p.Conn().Log().Error("Encode message failed", "err", err)
+		return
+	}
+	p.write(&msg)
+}
+
+// RequestFinalVote asks the player for a first and second choice. Each
+// choice is sent and acknowledged like an ordinary vote.
+func (p *RoomPlayer) RequestFinalVote(text string, answers []string, first string, deadline time.Time) {
+	var err error
+	msg := ConnMessage{Type: "final"}
+	msg.Data, err = json.Marshal(requestVoteMessage{Text: text, Answers: answers, First: first, Deadline: deadline, Seconds: secondsUntil(deadline)})
 	if err != nil {
-		log.Printf("RoomPlayer: %s", err)
+		p.Conn().Log().Error("Encode message failed", "err", err)
 		return
 	}
-	p.Conn.Write(&msg)
+	p.write(&msg)
 }
 
 func (p *RoomPlayer) Results(game *game.Game, results game.ResultSet) {
-	p.Conn.Write(&ConnMessage{Type: "results"})
+	p.write(&ConnMessage{Type: "results"})
 }
 
 func (p *RoomPlayer) Complete(game *game.Game) {
-	p.Conn.Write(&ConnMessage{Type: "complete"})
+	p.write(&ConnMessage{Type: "complete"})
+}
+
+type maintenanceMessage struct {
+	Deadline time.Time
+	Seconds  int
+}
+
+func newMaintenanceMessage(deadline time.Time) (*ConnMessage, error) {
+	var err error
+	msg := &ConnMessage{Type: "maintenance"}
+	msg.Data, err = json.Marshal(maintenanceMessage{Deadline: deadline, Seconds: secondsUntil(deadline)})
+	return msg, err
+}
+
+// SendMaintenance warns the player that the server is going down at
+// deadline.
+func (p *RoomPlayer) SendMaintenance(deadline time.Time) {
+	msg, err := newMaintenanceMessage(deadline)
+	if err != nil {
+		p.Conn().Log().Error("Encode message failed", "err", err)
+		return
+	}
+	p.write(msg)
+}
+
+type kickedMessage struct {
+	Reason string
+	Banned bool
+}
+
+// SendKicked tells the player they have been removed from the room, and
+// whether their browser is blocked from coming back.
+func (p *RoomPlayer) SendKicked(banned bool) {
+	var err error
+	reason := "You have been removed from the room"
+	if banned {
+		reason = ErrBanned.Error()
+	}
+	msg := ConnMessage{Type: "kicked"}
+	msg.Data, err = json.Marshal(kickedMessage{Reason: reason, Banned: banned})
+	if err != nil {
+		p.Conn().Log().Error("Encode message failed", "err", err)
+		return
+	}
+	p.write(&msg)
+}
+
+// SendLobby tells the player they are waiting for a new game to begin.
+func (p *RoomPlayer) SendLobby() {
+	p.write(&ConnMessage{Type: "lobby"})
 }
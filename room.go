@@ -1,52 +1,449 @@
 package main
 
 import (
+	"crypto/subtle"
 	"errors"
+	"log/slog"
+	"sort"
 	"sync"
+	"time"
 	"unicode/utf8"
 
 	"github.com/proglottis/tvgame/game"
+	"github.com/proglottis/tvgame/store"
+)
+
+var (
+	ErrNoRoom    = errors.New("No such room")
+	ErrNameShort = errors.New("Name is too short (min 1)")
+	ErrNameLong  = errors.New("Name is too long (max 10)")
+	ErrNameTaken = errors.New("Name is taken")
+	ErrNoPlayer  = errors.New("No such player")
+	ErrBanned    = errors.New("You have been blocked from rejoining this room")
 )
 
 type Room struct {
 	Code string
 
-	mu   sync.Mutex
-	game *game.Game
+	mu        sync.Mutex
+	repo      *game.QuestionRepo
+	packs     []string
+	used      game.History
+	standings map[*RoomPlayer]*Standing
+	game      *game.Game
+	created   time.Time
+	kicked    []*RoomPlayer
+	banned    map[string]struct{} // tokens of banned players
+	closed    bool
+	draining  bool
+	hostTimer *time.Timer
+	hostSeq   int
+	// store records each completed game, if set, and saves tracks the
+	// records still being written.
+	store store.Store
+	saves *sync.WaitGroup
+	// moderator checks player names and lies in each game, if set.
+	moderator game.Moderator
+}
+
+// NewRoom creates a room hosted on host, checking names and lies with
+// moderator if it is set.
+func NewRoom(repo *game.QuestionRepo, host *Conn, rules *game.Rules, moderator game.Moderator) *Room {
+	room := &Room{
+		repo:      repo,
+		moderator: moderator,
+		used:      game.History{},
+		standings: make(map[*RoomPlayer]*Standing),
+		created:   time.Now(),
+		banned:    make(map[string]struct{}),
+	}
+	room.newGame(NewRoomHost(host), rules)
+	return room
+}
+
+// newGame replaces the game in the room with a new one, drawing questions the
+// room has not played yet.
+func (r *Room) newGame(host *RoomHost, rules *game.Rules) {
+	r.game = game.New(r.repo, host, rules, r.used)
+	r.game.Clock = roomClock{room: r}
+	r.game.OnPhase = observePhase
+	r.game.Moderator = r.moderator
+	r.used.Add(r.game.Questions...)
+}
+
+// roomClock runs game timers while holding the room lock so that deadlines
+// are serialised with messages from the host and players.
+type roomClock struct {
+	room *Room
 }
 
-func NewRoom(repo *game.QuestionRepo, host *Conn) *Room {
-	return &Room{game: game.New(repo, &RoomHost{Conn: host})}
+func (c roomClock) Now() time.Time {
+	return time.Now()
+}
+
+func (c roomClock) AfterFunc(d time.Duration, f func()) game.Timer {
+	return time.AfterFunc(d, func() {
+		c.room.mu.Lock()
+		defer c.room.mu.Unlock()
+		f()
+	})
+}
+
+// secondsUntil rounds the time remaining before deadline up to whole seconds
+// for display.
+func secondsUntil(deadline time.Time) int {
+	if deadline.IsZero() {
+		return 0
+	}
+	d := time.Until(deadline)
+	if d <= 0 {
+		return 0
+	}
+	return int((d + time.Second - 1) / time.Second)
+}
+
+// Log returns the logger for the room.
+func (r *Room) Log() *slog.Logger {
+	return slog.Default().With("room", r.Code)
 }
 
 func (r *Room) Host() *RoomHost {
 	return r.game.Host.(*RoomHost)
 }
 
-func (r *Room) AddPlayer(player *RoomPlayer) error {
-	r.mu.Lock()
-	defer r.mu.Unlock()
+// checkName cleans the name of player and checks that it passes moderation
+// and that nobody in the room, playing or watching, is already using it.
+func (r *Room) checkName(player *RoomPlayer) error {
 	player.Name = game.CleanText(player.Name)
 	if utf8.RuneCountInString(player.Name) < 1 {
-		return errors.New("Name is too short (min 1)")
+		return ErrNameShort
 	}
 	if utf8.RuneCountInString(player.Name) > 10 {
-		return errors.New("Name is too long (max 10)")
+		return ErrNameLong
+	}
+	if err := r.game.Moderate(player.Name); err != nil {
+		return err
 	}
 	for other := range r.game.Players {
 		if other.(*RoomPlayer).Name == player.Name {
-			return errors.New("Name is taken")
+			return ErrNameTaken
 		}
 	}
+	for other := range r.game.Audience {
+		if other.(*RoomPlayer).Name == player.Name {
+			return ErrNameTaken
+		}
+	}
+	return nil
+}
+
+func (r *Room) AddPlayer(player *RoomPlayer) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.checkName(player); err != nil {
+		return err
+	}
 	if err := r.game.AddPlayer(player); err != nil {
 		return err
 	}
 	return nil
 }
 
+// AddAudience adds player to the audience of the room.
+func (r *Room) AddAudience(player *RoomPlayer) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.checkName(player); err != nil {
+		return err
+	}
+	if err := r.game.AddAudience(player); err != nil {
+		return err
+	}
+	r.Host().SendAudience(len(r.game.Audience))
+	return nil
+}
+
+// RejoinPlayer binds conn to the player holding token and replays the current
+// phase to them.
+func (r *Room) RejoinPlayer(token string, conn *Conn) (*RoomPlayer, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.banned[token]; ok {
+		return nil, ErrBanned
+	}
+	for p := range r.game.Players {
+		player := p.(*RoomPlayer)
+		if subtle.ConstantTimeCompare([]byte(player.Token), []byte(token)) == 1 {
+			player.setConn(conn)
+			player.SendJoined(r.Code)
+			r.game.MarkBack(player)
+			r.game.Replay(player)
+			return player, nil
+		}
+	}
+	return nil, ErrNoPlayer
+}
+
+// ReclaimHost binds conn to the host if token matches and re-sends the room
+// state so the host screen can be redrawn.
+func (r *Room) ReclaimHost(token string, conn *Conn) (*RoomHost, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	host := r.Host()
+	if r.closed || subtle.ConstantTimeCompare([]byte(host.Token), []byte(token)) != 1 {
+		return nil, errors.New("Cannot reclaim room")
+	}
+	r.hostSeq++
+	if r.hostTimer != nil {
+		r.hostTimer.Stop()
+		r.hostTimer = nil
+	}
+	host.setConn(conn)
+	if err := host.SendCreated(r.Code, r.game.Rules); err != nil {
+		return nil, err
+	}
+	if err := host.SendState(r.game); err != nil {
+		return nil, err
+	}
+	return host, nil
+}
+
+// HostAway keeps the room open for grace after the host connection conn is
+// lost. If the host has not reclaimed the room by then it is closed and
+// expire is called.
+func (r *Room) HostAway(conn *Conn, grace time.Duration, expire func()) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed || r.Host().Conn() != conn {
+		return
+	}
+	r.hostSeq++
+	seq := r.hostSeq
+	r.hostTimer = time.AfterFunc(grace, func() {
+		r.mu.Lock()
+		if seq != r.hostSeq || r.closed {
+			r.mu.Unlock()
+			return
+		}
+		r.close()
+		r.mu.Unlock()
+		expire()
+	})
+}
+
+// Close closes the room, unless it has closed already.
+func (r *Room) Close() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.closed {
+		r.close()
+	}
+}
+
+// Drain warns everyone in the room that the server is going down at
+// deadline, and stops new rounds from starting so the room can come to rest.
+func (r *Room) Drain(deadline time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.draining = true
+	if r.closed {
+		return
+	}
+	r.Host().SendMaintenance(deadline)
+	for p := range r.game.Players {
+		p.(*RoomPlayer).SendMaintenance(deadline)
+	}
+	for a := range r.game.Audience {
+		a.(*RoomPlayer).SendMaintenance(deadline)
+	}
+}
+
+// Idle reports whether the room is between rounds, or closed.
+func (r *Room) Idle() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	switch r.game.Phase() {
+	case game.PhaseLobby, game.PhaseResults, game.PhaseComplete:
+		return true
+	}
+	return r.closed
+}
+
+// close ends the game and disconnects everyone in the room.
+func (r *Room) close() {
+	r.closed = true
+	r.game.Close()
+	for p := range r.game.Players {
+		p.(*RoomPlayer).Conn().Close()
+	}
+	for a := range r.game.Audience {
+		a.(*RoomPlayer).Conn().Close()
+	}
+	r.Host().Conn().Close()
+}
+
+// PlayerAway handles the loss of the player connection conn. Before the game
+// starts the player is removed so their name and place are freed, afterwards
+// they are marked away until they rejoin. The audience simply leave.
+func (r *Room) PlayerAway(player *RoomPlayer, conn *Conn) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed || player.Conn() != conn {
+		return
+	}
+	if r.game.IsAudience(player) {
+		r.game.RemoveAudience(player)
+		r.Host().SendAudience(len(r.game.Audience))
+	} else if r.game.Phase() == game.PhaseLobby {
+		r.game.RemovePlayer(player)
+	} else {
+		r.game.MarkAway(player)
+	}
+}
+
+// Kick removes the player or audience member with id from the room, freeing
+// their name, and disconnects them. Anything a player wrote or voted for in
+// the round being played is withdrawn. If ban is set their token is refused
+// for the rest of the room's life. This only blocks the browser they played
+// in, which keeps the token and sends it when joining: from another browser,
+// a private window or with its storage cleared they can join again. Players
+// are not identified any further, they often share an address on the same
+// network.
+func (r *Room) Kick(id string, ban bool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var kicked *RoomPlayer
+	for a := range r.game.Audience {
+		if a.(*RoomPlayer).ID == id {
+			kicked = a.(*RoomPlayer)
+			r.game.RemoveAudience(kicked)
+			r.Host().SendAudience(len(r.game.Audience))
+		}
+	}
+	for p := range r.game.Players {
+		if p.(*RoomPlayer).ID == id {
+			kicked = p.(*RoomPlayer)
+			r.game.RemovePlayer(kicked)
+			delete(r.standings, kicked)
+		}
+	}
+	if kicked == nil {
+		return ErrNoPlayer
+	}
+	// Kicked players may still be named in the results of earlier rounds.
+	r.kicked = append(r.kicked, kicked)
+	if ban {
+		r.banned[kicked.Token] = struct{}{}
+	}
+	r.Log().Info("Kicked", "player", kicked.ID, "ban", ban)
+	r.Host().SendKicked(kicked)
+	kicked.SendKicked(ban)
+	kicked.Conn().Close()
+	return nil
+}
+
+// Banned reports whether the holder of token has been blocked from the room.
+func (r *Room) Banned(token string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_, ok := r.banned[token]
+	return ok
+}
+
+// Standing is a player's record across the games played in a room.
+type Standing struct {
+	Player *RoomPlayer
+	Total  int
+	Wins   int
+	Games  int
+}
+
+// recordStandings adds the scores of the completed game to the standings.
+func (r *Room) recordStandings() {
+	best := 0
+	for _, total := range r.game.Players {
+		best = max(best, total)
+	}
+	for p, total := range r.game.Players {
+		player := p.(*RoomPlayer)
+		standing, ok := r.standings[player]
+		if !ok {
+			standing = &Standing{Player: player}
+			r.standings[player] = standing
+		}
+		standing.Total += total
+		standing.Games++
+		if total == best && best > 0 {
+			standing.Wins++
+		}
+	}
+}
+
+// Standings returns the standings ordered by total score, highest first.
+func (r *Room) Standings() []*Standing {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.sortedStandings()
+}
+
+func (r *Room) sortedStandings() []*Standing {
+	standings := make([]*Standing, 0, len(r.standings))
+	for _, standing := range r.standings {
+		standings = append(standings, standing)
+	}
+	sort.Slice(standings, func(i, j int) bool {
+		if standings[i].Total != standings[j].Total {
+			return standings[i].Total > standings[j].Total
+		}
+		return standings[i].Player.Name < standings[j].Player.Name
+	})
+	return standings
+}
+
+// Rematch starts a new game with the players still connected once the
+// current game is complete. Unless carry is set the standings start over.
+func (r *Room) Rematch(carry bool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.game.Phase() != game.PhaseComplete {
+		return errors.New("Game is not complete")
+	}
+	if r.draining {
+		return errors.New("Server is shutting down")
+	}
+	if !carry {
+		r.standings = make(map[*RoomPlayer]*Standing)
+	}
+	old := r.game
+	old.Close()
+	r.newGame(r.Host(), old.Rules)
+	for p := range old.Players {
+		if !old.IsAway(p) {
+			player := p.(*RoomPlayer)
+			r.game.AddPlayer(player)
+			player.SendLobby()
+		}
+	}
+	for a := range old.Audience {
+		r.game.AddAudience(a)
+		a.(*RoomPlayer).SendLobby()
+	}
+	return r.Host().SendState(r.game)
+}
+
+// Replay re-sends whatever player needs for the current phase.
+func (r *Room) Replay(player *RoomPlayer) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.game.Replay(player)
+}
+
 func (r *Room) Begin() {
 	r.mu.Lock()
 	defer r.mu.Unlock()
+	if r.draining {
+		return
+	}
 	r.game.Begin()
 }
 
@@ -62,6 +459,12 @@ func (r *Room) Collect(player *RoomPlayer, text string) error {
 	return r.game.Collect(player, text)
 }
 
+func (r *Room) Like(player *RoomPlayer, text string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.game.Like(player, text)
+}
+
 func (r *Room) Stop() {
 	r.mu.Lock()
 	defer r.mu.Unlock()
@@ -71,5 +474,21 @@ func (r *Room) Stop() {
 func (r *Room) Next() {
 	r.mu.Lock()
 	defer r.mu.Unlock()
+	if r.game.Phase() != game.PhaseResults {
+		return
+	}
+	// The last round is allowed to complete, but no new round starts while
+	// the server is going down.
+	if r.draining && r.game.Current() != r.game.Questions[len(r.game.Questions)-1] {
+		return
+	}
 	r.game.Next()
+	if r.game.Phase() == game.PhaseComplete {
+		gamesCounter.Inc()
+		r.recordStandings()
+		r.Host().SendStandings(r.sortedStandings())
+		if r.store != nil {
+			saveGame(r.store, r.saves, gameRecord(r.Code, r.game))
+		}
+	}
 }
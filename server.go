@@ -2,34 +2,116 @@ package main
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
-	"math/rand"
+	"log/slog"
+	mathrand "math/rand"
+	"sort"
 	"sync"
+	"time"
 
 	"github.com/proglottis/tvgame/game"
+	"github.com/proglottis/tvgame/store"
 )
 
+type CreateRequest struct {
+	// Preset names the rules to start from, Rules then overrides any of
+	// their fields.
+	Preset string
+	Rules  json.RawMessage
+	// Packs names the question packs to play with, all packs are used if
+	// none are named.
+	Packs []string
+}
+
+// NewRules builds the rules requested by the host.
+func (r *CreateRequest) NewRules() (*game.Rules, error) {
+	rules, err := game.Preset(r.Preset)
+	if err != nil {
+		return nil, err
+	}
+	if len(r.Rules) > 0 {
+		if err := json.Unmarshal(r.Rules, rules); err != nil {
+			return nil, err
+		}
+	}
+	if err := rules.Validate(); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
 type JoinRequest struct {
 	Name string
 	Code string
+	// Token is the token last held in the room, if any, so that a banned
+	// player is refused.
+	Token string
+}
+
+type RejoinRequest struct {
+	Code  string
+	Token string
+}
+
+type ReclaimRequest struct {
+	Code  string
+	Token string
 }
 
 type Server struct {
-	Repo *game.QuestionRepo
+	Packs *PackLibrary
+	// HostGrace is how long a room survives without a host connection.
+	HostGrace time.Duration
+	// MaxRooms is the most rooms open at once, zero allows any number.
+	MaxRooms int
+	// Store records completed games, if set.
+	Store store.Store
+	// Moderator checks player names and lies, if set.
+	Moderator game.Moderator
 
-	mu    sync.RWMutex
-	rooms map[string]*Room
+	mu       sync.RWMutex
+	rooms    map[string]*Room
+	draining bool
+	// saves tracks completed games still being written to Store.
+	saves sync.WaitGroup
 }
 
-func NewServer(repo *game.QuestionRepo) *Server {
+func NewServer(packs *PackLibrary) *Server {
 	return &Server{
-		Repo:  repo,
-		rooms: make(map[string]*Room),
+		Packs:     packs,
+		HostGrace: 2 * time.Minute,
+		rooms:     make(map[string]*Room),
 	}
 }
 
+// repo merges the named packs, or every pack if none are named.
+func (s *Server) repo(names []string) (*game.QuestionRepo, error) {
+	packs := s.Packs.Packs()
+	if len(names) == 0 {
+		for name := range packs {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+	}
+	var repos []*game.QuestionRepo
+	for _, name := range names {
+		repo, ok := packs[name]
+		if !ok {
+			return nil, fmt.Errorf("Unknown pack: %s", name)
+		}
+		repos = append(repos, repo)
+	}
+	repo := game.MergeQuestionRepos(repos...)
+	if repo.Len() < 1 {
+		return nil, errors.New("No questions to play")
+	}
+	return repo, nil
+}
+
 func (s *Server) Handle(ctx context.Context, conn *Conn) error {
 	var msg ConnMessage
 	if err := conn.Read(&msg); err != nil {
@@ -37,29 +119,130 @@ func (s *Server) Handle(ctx context.Context, conn *Conn) error {
 	}
 	switch msg.Type {
 	case "create":
-		return s.CreateRoom(ctx, conn)
+		var req CreateRequest
+		if len(msg.Data) > 0 {
+			if err := json.Unmarshal(msg.Data, &req); err != nil {
+				return err
+			}
+		}
+		return s.CreateRoom(ctx, conn, &req)
 	case "join":
 		var req JoinRequest
 		if err := json.Unmarshal(msg.Data, &req); err != nil {
 			return err
 		}
 		return s.JoinRoom(ctx, conn, &req)
+	case "watch":
+		var req JoinRequest
+		if err := json.Unmarshal(msg.Data, &req); err != nil {
+			return err
+		}
+		return s.WatchRoom(ctx, conn, &req)
+	case "rejoin":
+		var req RejoinRequest
+		if err := json.Unmarshal(msg.Data, &req); err != nil {
+			return err
+		}
+		return s.RejoinRoom(ctx, conn, &req)
+	case "reclaim":
+		var req ReclaimRequest
+		if err := json.Unmarshal(msg.Data, &req); err != nil {
+			return err
+		}
+		return s.ReclaimRoom(ctx, conn, &req)
 	default:
 		return fmt.Errorf("Unknown message: %s", msg.Type)
 	}
 }
 
+// allRooms returns every room on the server.
+func (s *Server) allRooms() []*Room {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	rooms := make([]*Room, 0, len(s.rooms))
+	for _, room := range s.rooms {
+		rooms = append(rooms, room)
+	}
+	return rooms
+}
+
+// Drain stops new rooms being created and warns everyone connected that the
+// server is going down. It then waits until no room is part way through a
+// round, or until ctx is done.
+func (s *Server) Drain(ctx context.Context) error {
+	s.mu.Lock()
+	s.draining = true
+	s.mu.Unlock()
+	deadline, _ := ctx.Deadline()
+	rooms := s.allRooms()
+	for _, room := range rooms {
+		room.Drain(deadline)
+	}
+	ticker := time.NewTicker(250 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		idle := true
+		for _, room := range rooms {
+			if !room.Idle() {
+				idle = false
+				break
+			}
+		}
+		if idle {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Close closes every room, disconnecting everyone in them, then waits for
+// the games they finished to be saved.
+func (s *Server) Close() {
+	s.mu.Lock()
+	rooms := s.rooms
+	s.rooms = make(map[string]*Room)
+	roomsGauge.Set(0)
+	s.mu.Unlock()
+	for _, room := range rooms {
+		room.Close()
+	}
+	// Closed rooms finish no more games, wait for those already finished to
+	// be saved before the store is closed.
+	s.saves.Wait()
+}
+
 func (s *Server) detachRoom(code string) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	log.Printf("Server: Detaching room: %s", code)
+	slog.Info("Detaching room", "room", code)
 	delete(s.rooms, code)
+	roomsGauge.Set(float64(len(s.rooms)))
+}
+
+func (s *Server) room(code string) (*Room, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	room, ok := s.rooms[code]
+	return room, ok
 }
 
-func (s *Server) createRoom(conn *Conn) *Room {
+func (s *Server) createRoom(conn *Conn, repo *game.QuestionRepo, rules *game.Rules, packs []string) (*Room, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	room := NewRoom(s.Repo, conn)
+	if s.draining {
+		return nil, errors.New("Server is shutting down, try again shortly")
+	}
+	if s.MaxRooms > 0 && len(s.rooms) >= s.MaxRooms {
+		return nil, errors.New("Too many rooms are open, try again later")
+	}
+	room := NewRoom(repo, conn, rules, s.Moderator)
+	room.packs = packs
+	room.store = s.Store
+	room.saves = &s.saves
 	for {
 		room.Code = generateCode(4)
 		if _, ok := s.rooms[room.Code]; !ok {
@@ -67,36 +250,141 @@ func (s *Server) createRoom(conn *Conn) *Room {
 		}
 	}
 	s.rooms[room.Code] = room
-	return room
+	roomsGauge.Set(float64(len(s.rooms)))
+	return room, nil
 }
 
-func (s *Server) CreateRoom(ctx context.Context, conn *Conn) error {
-	room := s.createRoom(conn)
-	log.Printf("Server: room %s created", room.Code)
-	detach := func() {
+func (s *Server) CreateRoom(ctx context.Context, conn *Conn, msg *CreateRequest) error {
+	rules, err := msg.NewRules()
+	if err != nil {
+		sendError(conn, err.Error())
+		return err
+	}
+	repo, err := s.repo(msg.Packs)
+	if err != nil {
+		sendError(conn, err.Error())
+		return err
+	}
+	room, err := s.createRoom(conn, repo, rules, msg.Packs)
+	if err != nil {
+		sendError(conn, err.Error())
+		return err
+	}
+	conn.With("room", room.Code, "role", "host")
+	conn.Log().Info("Room created")
+	if err := room.Host().SendCreated(room.Code, rules); err != nil {
 		s.detachRoom(room.Code)
+		return err
+	}
+	return s.runHost(ctx, room, conn)
+}
+
+func (s *Server) ReclaimRoom(ctx context.Context, conn *Conn, msg *ReclaimRequest) error {
+	msg.Code = game.CleanText(msg.Code)
+	room, ok := s.room(msg.Code)
+	if !ok {
+		err := fmt.Errorf("%w: %s", ErrNoRoom, msg.Code)
+		sendError(conn, err.Error())
+		return err
+	}
+	if _, err := room.ReclaimHost(msg.Token, conn); err != nil {
+		sendError(conn, err.Error())
+		return err
 	}
-	defer detach()
-	return room.Host().Run(ctx, room, detach)
+	conn.With("room", room.Code, "role", "host")
+	conn.Log().Info("Host reclaimed room")
+	return s.runHost(ctx, room, conn)
+}
+
+// runHost runs the host on conn until it disconnects, then gives the host
+// HostGrace to reclaim the room before it is detached.
+func (s *Server) runHost(ctx context.Context, room *Room, conn *Conn) error {
+	defer connected("host")()
+	err := room.Host().Run(ctx, room)
+	room.HostAway(conn, s.HostGrace, func() {
+		s.detachRoom(room.Code)
+	})
+	return err
 }
 
 func (s *Server) JoinRoom(ctx context.Context, conn *Conn, msg *JoinRequest) error {
-	player := &RoomPlayer{ID: generateCode(10), Name: game.CleanText(msg.Name), Conn: conn}
+	player := NewRoomPlayer(msg.Name, conn)
 	msg.Code = game.CleanText(msg.Code)
-	s.mu.RLock()
-	room, ok := s.rooms[msg.Code]
-	s.mu.RUnlock()
+	room, ok := s.room(msg.Code)
 	if !ok {
-		err := fmt.Errorf("No such room: %s", msg.Code)
+		err := fmt.Errorf("%w: %s", ErrNoRoom, msg.Code)
+		countJoinFailure(err)
 		player.SendError(err.Error())
 		return err
 	}
+	if msg.Token != "" && room.Banned(msg.Token) {
+		countJoinFailure(ErrBanned)
+		player.SendError(ErrBanned.Error())
+		return ErrBanned
+	}
 	if err := room.AddPlayer(player); err != nil {
+		countJoinFailure(err)
 		player.SendError(err.Error())
 		return err
 	}
-	log.Printf("Server: joined player to room %s", msg.Code)
-	player.SendAck()
+	conn.With("room", room.Code, "role", "player", "player", player.ID)
+	conn.Log().Info("Player joined")
+	player.SendJoined(room.Code)
+	defer connected("player")()
+	defer room.PlayerAway(player, conn)
+	return player.Run(ctx, room)
+}
+
+// WatchRoom joins conn to the audience of a room. The audience vote for their
+// favourite lie but do not answer or score.
+func (s *Server) WatchRoom(ctx context.Context, conn *Conn, msg *JoinRequest) error {
+	player := NewRoomPlayer(msg.Name, conn)
+	msg.Code = game.CleanText(msg.Code)
+	room, ok := s.room(msg.Code)
+	if !ok {
+		err := fmt.Errorf("%w: %s", ErrNoRoom, msg.Code)
+		countJoinFailure(err)
+		player.SendError(err.Error())
+		return err
+	}
+	if msg.Token != "" && room.Banned(msg.Token) {
+		countJoinFailure(ErrBanned)
+		player.SendError(ErrBanned.Error())
+		return ErrBanned
+	}
+	if err := room.AddAudience(player); err != nil {
+		countJoinFailure(err)
+		player.SendError(err.Error())
+		return err
+	}
+	conn.With("room", room.Code, "role", "audience", "player", player.ID)
+	conn.Log().Info("Audience joined")
+	player.SendJoined(room.Code)
+	room.Replay(player)
+	defer connected("audience")()
+	defer room.PlayerAway(player, conn)
+	return player.Run(ctx, room)
+}
+
+func (s *Server) RejoinRoom(ctx context.Context, conn *Conn, msg *RejoinRequest) error {
+	msg.Code = game.CleanText(msg.Code)
+	room, ok := s.room(msg.Code)
+	if !ok {
+		err := fmt.Errorf("%w: %s", ErrNoRoom, msg.Code)
+		countJoinFailure(err)
+		sendError(conn, err.Error())
+		return err
+	}
+	player, err := room.RejoinPlayer(msg.Token, conn)
+	if err != nil {
+		countJoinFailure(err)
+		sendError(conn, err.Error())
+		return err
+	}
+	conn.With("room", room.Code, "role", "player", "player", player.ID)
+	conn.Log().Info("Player rejoined")
+	defer connected("player")()
+	defer room.PlayerAway(player, conn)
 	return player.Run(ctx, room)
 }
 
@@ -105,7 +393,16 @@ const letters = "ABCDEFGHIJKLMNOPQRSTUVWXYZ"
 func generateCode(n int) string {
 	msg := make([]byte, n)
 	for i := range msg {
-		msg[i] = letters[rand.Intn(len(letters))]
+		msg[i] = letters[mathrand.Intn(len(letters))]
 	}
 	return game.CleanText(string(msg))
 }
+
+// generateToken returns a secret suitable for resuming a session.
+func generateToken() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
@@ -7,24 +7,29 @@ import (
 	"net/http/httptest"
 	"net/url"
 	"os"
+	"path/filepath"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/bitly/go-simplejson"
 	"github.com/gorilla/websocket"
-	"github.com/proglottis/tvgame/game"
+	"github.com/proglottis/tvgame/store"
 )
 
-func TestServer_joining(t *testing.T) {
-	csv, err := os.Open("testdata/quiz.csv")
-	if err != nil {
-		t.Fatal(err)
-	}
-	repo, err := game.NewQuestionRepo(csv)
+func newTestServer(t *testing.T) (*httptest.Server, *url.URL) {
+	httpServer, serverURL, _ := newTestServerWithServer(t)
+	return httpServer, serverURL
+}
+
+func newTestServerWithServer(t *testing.T) (*httptest.Server, *url.URL, *Server) {
+	packs, err := NewPackLibrary([]string{"testdata/quiz.csv"})
 	if err != nil {
 		t.Fatal(err)
 	}
-	server := NewServer(repo)
+	server := NewServer(packs)
 	upgrader := websocket.Upgrader{
 		ReadBufferSize:  1024,
 		WriteBufferSize: 1024,
@@ -41,12 +46,50 @@ func TestServer_joining(t *testing.T) {
 			return
 		}
 	}))
-	defer httpServer.Close()
 	serverURL, err := url.Parse(httpServer.URL)
 	if err != nil {
 		t.Fatal(err)
 	}
 	serverURL.Scheme = "ws"
+	return httpServer, serverURL, server
+}
+
+// readMessage reads the next message from ws, failing unless it has the
+// expected type.
+func readMessage(t *testing.T, ws *websocket.Conn, expected string) *simplejson.Json {
+	_, msg, err := ws.ReadMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc, err := simplejson.NewJson(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if typ := doc.Get("Type").MustString(); typ != expected {
+		t.Fatalf("Expected %q message, got %s", expected, msg)
+	}
+	return doc
+}
+
+// sendMessage writes msg to ws.
+func sendMessage(t *testing.T, ws *websocket.Conn, msg string) {
+	if err := ws.WriteMessage(websocket.TextMessage, []byte(msg)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// dial connects a client to the test server at serverURL.
+func dial(t *testing.T, serverURL *url.URL) *websocket.Conn {
+	ws, _, err := websocket.DefaultDialer.Dial(serverURL.String(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ws
+}
+
+func TestServer_joining(t *testing.T) {
+	httpServer, serverURL := newTestServer(t)
+	defer httpServer.Close()
 
 	var wg sync.WaitGroup
 	for i := 0; i < 10; i++ {
@@ -108,3 +151,422 @@ func TestServer_joining(t *testing.T) {
 	}
 	wg.Wait()
 }
+
+func TestServer_rejoin(t *testing.T) {
+	httpServer, serverURL := newTestServer(t)
+	defer httpServer.Close()
+
+	host, _, err := websocket.DefaultDialer.Dial(serverURL.String(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer host.Close()
+	if err := host.WriteMessage(websocket.TextMessage, []byte(`{"Type":"create"}`)); err != nil {
+		t.Fatal(err)
+	}
+	code := readMessage(t, host, "create").GetPath("Data", "Code").MustString()
+
+	player, _, err := websocket.DefaultDialer.Dial(serverURL.String(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := player.WriteMessage(websocket.TextMessage, []byte(fmt.Sprintf(`{"Type":"join","Data":{"Code":"%s","Name":"bob"}}`, code))); err != nil {
+		t.Fatal(err)
+	}
+	token := readMessage(t, player, "ok").GetPath("Data", "Token").MustString()
+	readMessage(t, host, "joined")
+	if err := host.WriteMessage(websocket.TextMessage, []byte(`{"Type":"begin"}`)); err != nil {
+		t.Fatal(err)
+	}
+	readMessage(t, player, "answer")
+	player.Close()
+
+	player, _, err = websocket.DefaultDialer.Dial(serverURL.String(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer player.Close()
+	if err := player.WriteMessage(websocket.TextMessage, []byte(fmt.Sprintf(`{"Type":"rejoin","Data":{"Code":"%s","Token":"%s"}}`, code, token))); err != nil {
+		t.Fatal(err)
+	}
+	readMessage(t, player, "ok")
+	readMessage(t, player, "answer")
+}
+
+func TestServer_reclaim(t *testing.T) {
+	httpServer, serverURL, server := newTestServerWithServer(t)
+	defer httpServer.Close()
+	server.HostGrace = 50 * time.Millisecond
+
+	host, _, err := websocket.DefaultDialer.Dial(serverURL.String(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := host.WriteMessage(websocket.TextMessage, []byte(`{"Type":"create"}`)); err != nil {
+		t.Fatal(err)
+	}
+	doc := readMessage(t, host, "create")
+	code := doc.GetPath("Data", "Code").MustString()
+	token := doc.GetPath("Data", "Token").MustString()
+	host.Close()
+
+	reclaim := func() *websocket.Conn {
+		host, _, err := websocket.DefaultDialer.Dial(serverURL.String(), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := host.WriteMessage(websocket.TextMessage, []byte(fmt.Sprintf(`{"Type":"reclaim","Data":{"Code":"%s","Token":"%s"}}`, code, token))); err != nil {
+			t.Fatal(err)
+		}
+		return host
+	}
+
+	host = reclaim()
+	readMessage(t, host, "create")
+	if phase := readMessage(t, host, "state").GetPath("Data", "Phase").MustString(); phase != "lobby" {
+		t.Errorf("Expected lobby phase, got %q", phase)
+	}
+	host.Close()
+
+	time.Sleep(200 * time.Millisecond)
+	host = reclaim()
+	defer host.Close()
+	readMessage(t, host, "error")
+}
+
+func TestServer_create_rules(t *testing.T) {
+	httpServer, serverURL := newTestServer(t)
+	defer httpServer.Close()
+
+	create := func(data string) *websocket.Conn {
+		host, _, err := websocket.DefaultDialer.Dial(serverURL.String(), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := host.WriteMessage(websocket.TextMessage, []byte(`{"Type":"create","Data":`+data+`}`)); err != nil {
+			t.Fatal(err)
+		}
+		return host
+	}
+
+	host := create(`{"Preset":"party","Rules":{"VoteSeconds":15}}`)
+	defer host.Close()
+	rules := readMessage(t, host, "create").GetPath("Data", "Rules")
+	if rounds := rules.Get("Rounds").MustInt(); rounds != 5 {
+		t.Errorf("Expected 5 rounds from preset, got %d", rounds)
+	}
+	if seconds := rules.Get("VoteSeconds").MustInt(); seconds != 15 {
+		t.Errorf("Expected 15 vote seconds, got %d", seconds)
+	}
+
+	// Naming many packs makes for a create larger than other messages.
+	packs := `"quiz"` + strings.Repeat(`,"quiz"`, 100)
+	host = create(`{"Packs":[` + packs + `]}`)
+	defer host.Close()
+	readMessage(t, host, "create")
+
+	for _, data := range []string{`{"Preset":"nonexistent"}`, `{"Rules":{"Rounds":0}}`, `{"Packs":["nonexistent"]}`} {
+		host := create(data)
+		readMessage(t, host, "error")
+		host.Close()
+	}
+}
+
+func TestPackLibrary_Reload(t *testing.T) {
+	dir := t.TempDir()
+	writePack := func(name, content string) {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writePack("fruit.csv", "A?,Apple\nB?,Banana")
+	packs, err := NewPackLibrary([]string{dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fruit := packs.Packs()["fruit"]
+	if fruit == nil || fruit.Len() != 2 {
+		t.Fatalf("Expected fruit pack with 2 questions, got %v", packs.List())
+	}
+
+	writePack("rivers.json", `{"title":"Rivers","questions":[{"question":"Longest?","answer":"Nile"}]}`)
+	if err := packs.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if list := packs.List(); len(list) != 2 || list[1].Title != "Rivers" {
+		t.Errorf("Expected fruit and rivers packs, got %v", list)
+	}
+	if packs.Packs()["fruit"] == fruit {
+		t.Errorf("Expected fruit pack to be reloaded")
+	}
+
+	writePack("broken.csv", "A?")
+	if err := packs.Reload(); err == nil {
+		t.Errorf("Expected reload error")
+	}
+	if list := packs.List(); len(list) != 2 {
+		t.Errorf("Expected previous packs to be kept, got %v", list)
+	}
+}
+
+func TestServer_rematch(t *testing.T) {
+	httpServer, serverURL := newTestServer(t)
+	defer httpServer.Close()
+
+	host := dial(t, serverURL)
+	defer host.Close()
+	sendMessage(t, host, `{"Type":"create","Data":{"Rules":{"Rounds":1}}}`)
+	code := readMessage(t, host, "create").GetPath("Data", "Code").MustString()
+
+	player := dial(t, serverURL)
+	defer player.Close()
+	sendMessage(t, player, fmt.Sprintf(`{"Type":"join","Data":{"Code":"%s","Name":"bob"}}`, code))
+	readMessage(t, player, "ok")
+	readMessage(t, host, "joined")
+
+	sendMessage(t, host, `{"Type":"begin"}`)
+	readMessage(t, host, "question")
+	readMessage(t, player, "answer")
+	sendMessage(t, player, `{"Type":"answer","Data":{"Text":"xyzzyx"}}`)
+	readMessage(t, player, "ok")
+	readMessage(t, host, "collected")
+	sendMessage(t, host, `{"Type":"vote"}`)
+	readMessage(t, host, "vote")
+	truth := readMessage(t, player, "vote").GetPath("Data", "Answers").GetIndex(0).MustString()
+	sendMessage(t, player, fmt.Sprintf(`{"Type":"vote","Data":{"Text":"%s"}}`, truth))
+	readMessage(t, player, "ok")
+	readMessage(t, host, "collected")
+	sendMessage(t, host, `{"Type":"stop"}`)
+	readMessage(t, host, "results")
+	readMessage(t, player, "results")
+	sendMessage(t, host, `{"Type":"next"}`)
+	readMessage(t, host, "complete")
+	readMessage(t, player, "complete")
+	standing := readMessage(t, host, "standings").GetPath("Data", "Standings").GetIndex(0)
+	if total := standing.Get("Total").MustInt(); total != 1500 {
+		t.Errorf("Expected total of 1500, got %d", total)
+	}
+	if wins := standing.Get("Wins").MustInt(); wins != 1 {
+		t.Errorf("Expected 1 win, got %d", wins)
+	}
+
+	sendMessage(t, host, `{"Type":"rematch","Data":{"Carry":true}}`)
+	readMessage(t, host, "joined")
+	if phase := readMessage(t, host, "state").GetPath("Data", "Phase").MustString(); phase != "lobby" {
+		t.Errorf("Expected lobby phase, got %q", phase)
+	}
+	readMessage(t, player, "lobby")
+	sendMessage(t, host, `{"Type":"begin"}`)
+	readMessage(t, player, "answer")
+}
+
+func TestServer_snapshots(t *testing.T) {
+	httpServer, serverURL, server := newTestServerWithServer(t)
+	defer httpServer.Close()
+
+	host := dial(t, serverURL)
+	defer host.Close()
+	sendMessage(t, host, `{"Type":"create"}`)
+	created := readMessage(t, host, "create")
+	code := created.GetPath("Data", "Code").MustString()
+	hostToken := created.GetPath("Data", "Token").MustString()
+	player := dial(t, serverURL)
+	defer player.Close()
+	sendMessage(t, player, fmt.Sprintf(`{"Type":"join","Data":{"Code":"%s","Name":"bob"}}`, code))
+	playerToken := readMessage(t, player, "ok").GetPath("Data", "Token").MustString()
+	readMessage(t, host, "joined")
+	sendMessage(t, host, `{"Type":"begin"}`)
+	readMessage(t, player, "answer")
+
+	dir := t.TempDir()
+	if err := server.SaveSnapshots(dir); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, code+".json")); err != nil {
+		t.Fatal(err)
+	}
+
+	restartedServer, restartedURL, restarted := newTestServerWithServer(t)
+	defer restartedServer.Close()
+	if err := restarted.LoadSnapshots(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	newHost := dial(t, restartedURL)
+	defer newHost.Close()
+	sendMessage(t, newHost, fmt.Sprintf(`{"Type":"reclaim","Data":{"Code":"%s","Token":"%s"}}`, code, hostToken))
+	readMessage(t, newHost, "create")
+	state := readMessage(t, newHost, "state")
+	if phase := state.GetPath("Data", "Phase").MustString(); phase != "answer" {
+		t.Errorf("Expected answer phase, got %q", phase)
+	}
+	if away := state.GetPath("Data", "Away").MustArray(); len(away) != 1 {
+		t.Errorf("Expected the player to be away until they rejoin, got %v", away)
+	}
+
+	newPlayer := dial(t, restartedURL)
+	defer newPlayer.Close()
+	sendMessage(t, newPlayer, fmt.Sprintf(`{"Type":"rejoin","Data":{"Code":"%s","Token":"%s"}}`, code, playerToken))
+	readMessage(t, newPlayer, "ok")
+	readMessage(t, newPlayer, "answer")
+	readMessage(t, newHost, "joined")
+	sendMessage(t, newPlayer, `{"Type":"answer","Data":{"Text":"xyzzyx"}}`)
+	readMessage(t, newPlayer, "ok")
+	if complete := readMessage(t, newHost, "collected").GetPath("Data", "Complete").MustBool(); !complete {
+		t.Errorf("Expected answers to be complete")
+	}
+}
+
+func TestServer_drain(t *testing.T) {
+	httpServer, serverURL, server := newTestServerWithServer(t)
+	defer httpServer.Close()
+	host := dial(t, serverURL)
+	defer host.Close()
+	sendMessage(t, host, `{"Type":"create"}`)
+	code := readMessage(t, host, "create").GetPath("Data", "Code").MustString()
+	player := dial(t, serverURL)
+	defer player.Close()
+	sendMessage(t, player, fmt.Sprintf(`{"Type":"join","Data":{"Code":"%s","Name":"bob"}}`, code))
+	readMessage(t, player, "ok")
+	readMessage(t, host, "joined")
+	sendMessage(t, host, `{"Type":"begin"}`)
+	readMessage(t, host, "question")
+	readMessage(t, player, "answer")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	drained := make(chan error, 1)
+	go func() {
+		drained <- server.Drain(ctx)
+	}()
+	readMessage(t, host, "maintenance")
+	readMessage(t, player, "maintenance")
+
+	late := dial(t, serverURL)
+	defer late.Close()
+	sendMessage(t, late, `{"Type":"create"}`)
+	readMessage(t, late, "error")
+
+	sendMessage(t, player, `{"Type":"answer","Data":{"Text":"xyzzyx"}}`)
+	readMessage(t, player, "ok")
+	readMessage(t, host, "collected")
+	sendMessage(t, host, `{"Type":"vote"}`)
+	readMessage(t, host, "vote")
+	truth := readMessage(t, player, "vote").GetPath("Data", "Answers").GetIndex(0).MustString()
+	sendMessage(t, player, fmt.Sprintf(`{"Type":"vote","Data":{"Text":"%s"}}`, truth))
+	readMessage(t, player, "ok")
+	readMessage(t, host, "collected")
+	sendMessage(t, host, `{"Type":"stop"}`)
+	readMessage(t, host, "results")
+	if err := <-drained; err != nil {
+		t.Errorf("Expected the room to drain once the round was scored, got %s", err)
+	}
+}
+
+func TestServer_kick(t *testing.T) {
+	httpServer, serverURL := newTestServer(t)
+	defer httpServer.Close()
+
+	host := dial(t, serverURL)
+	defer host.Close()
+	sendMessage(t, host, `{"Type":"create"}`)
+	code := readMessage(t, host, "create").GetPath("Data", "Code").MustString()
+	player := dial(t, serverURL)
+	defer player.Close()
+	sendMessage(t, player, fmt.Sprintf(`{"Type":"join","Data":{"Code":"%s","Name":"bob"}}`, code))
+	joined := readMessage(t, player, "ok")
+	id := joined.GetPath("Data", "ID").MustString()
+	token := joined.GetPath("Data", "Token").MustString()
+	readMessage(t, host, "joined")
+
+	sendMessage(t, host, fmt.Sprintf(`{"Type":"kick","Data":{"Player":"%s","Ban":true}}`, id))
+	readMessage(t, host, "left")
+	readMessage(t, host, "kicked")
+	if !readMessage(t, player, "kicked").GetPath("Data", "Banned").MustBool() {
+		t.Errorf("Expected the player to be banned")
+	}
+
+	rejoin := dial(t, serverURL)
+	defer rejoin.Close()
+	sendMessage(t, rejoin, fmt.Sprintf(`{"Type":"rejoin","Data":{"Code":"%s","Token":"%s"}}`, code, token))
+	readMessage(t, rejoin, "error")
+	banned := dial(t, serverURL)
+	defer banned.Close()
+	sendMessage(t, banned, fmt.Sprintf(`{"Type":"join","Data":{"Code":"%s","Name":"bobby","Token":"%s"}}`, code, token))
+	readMessage(t, banned, "error")
+
+	other := dial(t, serverURL)
+	defer other.Close()
+	sendMessage(t, other, fmt.Sprintf(`{"Type":"join","Data":{"Code":"%s","Name":"bob"}}`, code))
+	readMessage(t, other, "ok")
+}
+
+func TestConn_Close(t *testing.T) {
+	upgrader := websocket.Upgrader{}
+	httpServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ws, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			panic(err)
+		}
+		conn := NewConn(context.Background(), ws)
+		for i := 0; i < 100; i++ {
+			conn.Write(&ConnMessage{Type: "results"})
+		}
+		conn.Write(&ConnMessage{Type: "kicked"})
+		conn.Close()
+	}))
+	defer httpServer.Close()
+	serverURL, err := url.Parse(httpServer.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverURL.Scheme = "ws"
+
+	ws := dial(t, serverURL)
+	defer ws.Close()
+	for i := 0; i < 100; i++ {
+		readMessage(t, ws, "results")
+	}
+	// Messages queued before closing, such as the reason for a kick, are
+	// written before the connection closes.
+	readMessage(t, ws, "kicked")
+	if _, _, err := ws.ReadMessage(); err == nil {
+		t.Errorf("Expected the connection to be closed")
+	}
+}
+
+// slowStore is a store.Store that holds each save until released.
+type slowStore struct {
+	store.Store
+	release chan struct{}
+	saved   atomic.Bool
+}
+
+func (s *slowStore) SaveGame(g *store.Game) error {
+	<-s.release
+	s.saved.Store(true)
+	return nil
+}
+
+func TestServer_Close_saves(t *testing.T) {
+	s := &slowStore{release: make(chan struct{})}
+	server := NewServer(nil)
+	server.Store = s
+	saveGame(server.Store, &server.saves, &store.Game{})
+
+	closed := make(chan struct{})
+	go func() {
+		server.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+		t.Fatal("Expected Close to wait for the game to be saved")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(s.release)
+	<-closed
+	if !s.saved.Load() {
+		t.Errorf("Expected the game to be saved")
+	}
+}
@@ -0,0 +1,294 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/proglottis/tvgame/game"
+)
+
+type playerSnapshot struct {
+	ID     string
+	Name   string
+	Token  string
+	Kicked bool `json:",omitempty"`
+}
+
+type standingSnapshot struct {
+	Player string
+	Total  int
+	Wins   int
+	Games  int
+}
+
+// roomSnapshot is everything needed to bring a room back after a restart,
+// including the resume tokens so the host and players can reconnect.
+type roomSnapshot struct {
+	Code      string
+	Created   time.Time
+	HostToken string
+	Packs     []string `json:",omitempty"`
+	Used      []string `json:",omitempty"`
+	Players   []playerSnapshot
+	Standings []standingSnapshot `json:",omitempty"`
+	Banned    []string           `json:",omitempty"`
+	Game      *game.Snapshot
+}
+
+// closedConn stands in for the connection of a host or player who has yet to
+// reconnect to a restored room. Anything written to it is dropped.
+func closedConn() *Conn {
+	done := make(chan struct{})
+	close(done)
+	conn := &Conn{done: done, cancel: func() {}}
+	conn.log.Store(slog.Default())
+	return conn
+}
+
+// Snapshot returns the state of the room, or nil once it has closed.
+func (r *Room) Snapshot() *roomSnapshot {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return nil
+	}
+	s := &roomSnapshot{
+		Code:      r.Code,
+		Created:   r.created,
+		HostToken: r.Host().Token,
+		Packs:     r.packs,
+		Game:      r.game.Snapshot(func(p game.Player) string { return p.(*RoomPlayer).ID }),
+	}
+	for text := range r.used {
+		s.Used = append(s.Used, text)
+	}
+	players := make(map[*RoomPlayer]struct{})
+	for p := range r.game.Players {
+		players[p.(*RoomPlayer)] = struct{}{}
+	}
+	for player, standing := range r.standings {
+		players[player] = struct{}{}
+		s.Standings = append(s.Standings, standingSnapshot{
+			Player: player.ID,
+			Total:  standing.Total,
+			Wins:   standing.Wins,
+			Games:  standing.Games,
+		})
+	}
+	for player := range players {
+		s.Players = append(s.Players, playerSnapshot{ID: player.ID, Name: player.Name, Token: player.Token})
+	}
+	for _, player := range r.kicked {
+		s.Players = append(s.Players, playerSnapshot{ID: player.ID, Name: player.Name, Token: player.Token, Kicked: true})
+	}
+	for token := range r.banned {
+		s.Banned = append(s.Banned, token)
+	}
+	return s
+}
+
+// restoreRoom recreates the room in s, playing questions from repo in later
+// games. Nobody is connected to the restored room, so everyone starts away.
+func restoreRoom(s *roomSnapshot, repo *game.QuestionRepo, moderator game.Moderator) (*Room, error) {
+	if s.Game == nil {
+		return nil, fmt.Errorf("Room %s has no game", s.Code)
+	}
+	players := make(map[string]*RoomPlayer)
+	var ids []string
+	for _, p := range s.Players {
+		players[p.ID] = &RoomPlayer{ID: p.ID, Name: p.Name, Token: p.Token, conn: closedConn()}
+		ids = append(ids, p.ID)
+	}
+	host := &RoomHost{Token: s.HostToken, conn: closedConn()}
+	g, err := game.Restore(s.Game, host, func(id string) game.Player {
+		player, ok := players[id]
+		if !ok {
+			return nil
+		}
+		return player
+	}, ids)
+	if err != nil {
+		return nil, fmt.Errorf("Room %s: %s", s.Code, err)
+	}
+	room := &Room{
+		Code:      s.Code,
+		repo:      repo,
+		packs:     s.Packs,
+		used:      game.History{},
+		standings: make(map[*RoomPlayer]*Standing),
+		game:      g,
+		moderator: moderator,
+		created:   s.Created,
+		banned:    make(map[string]struct{}),
+	}
+	if room.created.IsZero() {
+		// Snapshots taken before rooms recorded their age.
+		room.created = time.Now()
+	}
+	for _, text := range s.Used {
+		room.used[text] = struct{}{}
+	}
+	for _, p := range s.Players {
+		if p.Kicked {
+			room.kicked = append(room.kicked, players[p.ID])
+		}
+	}
+	for _, token := range s.Banned {
+		room.banned[token] = struct{}{}
+	}
+	for _, standing := range s.Standings {
+		player, ok := players[standing.Player]
+		if !ok {
+			return nil, fmt.Errorf("Room %s: unknown player: %s", s.Code, standing.Player)
+		}
+		room.standings[player] = &Standing{
+			Player: player,
+			Total:  standing.Total,
+			Wins:   standing.Wins,
+			Games:  standing.Games,
+		}
+	}
+	g.Clock = roomClock{room: room}
+	g.OnPhase = observePhase
+	g.Moderator = moderator
+	g.Resume()
+	return room, nil
+}
+
+// writeFile replaces the file at path with data, so that a crash part way
+// through leaves the previous file intact.
+func writeFile(path string, data []byte) error {
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// SaveSnapshots writes a snapshot of every room to dir, one file per room,
+// and removes the snapshots of rooms that have gone.
+func (s *Server) SaveSnapshots(dir string) error {
+	keep := make(map[string]struct{})
+	for _, room := range s.allRooms() {
+		snapshot := room.Snapshot()
+		if snapshot == nil {
+			continue
+		}
+		buf, err := json.Marshal(snapshot)
+		if err != nil {
+			return err
+		}
+		name := snapshot.Code + ".json"
+		if err := writeFile(filepath.Join(dir, name), buf); err != nil {
+			return err
+		}
+		keep[name] = struct{}{}
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		if _, ok := keep[filepath.Base(file)]; !ok {
+			if err := os.Remove(file); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// LoadSnapshots restores the rooms snapshotted in dir. The hosts of restored
+// rooms have HostGrace to reclaim them. Rooms that cannot be restored are
+// logged and skipped.
+func (s *Server) LoadSnapshots(dir string) error {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		room, err := s.loadSnapshot(file)
+		if err != nil {
+			slog.Error("Restore failed", "file", file, "err", err)
+			continue
+		}
+		room.Log().Info("Room restored")
+	}
+	return nil
+}
+
+func (s *Server) loadSnapshot(path string) (*Room, error) {
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var snapshot roomSnapshot
+	if err := json.Unmarshal(buf, &snapshot); err != nil {
+		return nil, err
+	}
+	if snapshot.Code != strings.TrimSuffix(filepath.Base(path), ".json") {
+		return nil, fmt.Errorf("Snapshot is for room %s", snapshot.Code)
+	}
+	repo, err := s.repo(snapshot.Packs)
+	if err != nil {
+		// The packs may have been removed since, carry on with what there is.
+		if repo, err = s.repo(nil); err != nil {
+			return nil, err
+		}
+	}
+	room, err := restoreRoom(&snapshot, repo, s.Moderator)
+	if err != nil {
+		return nil, err
+	}
+	room.store = s.Store
+	room.saves = &s.saves
+	s.mu.Lock()
+	if _, ok := s.rooms[room.Code]; ok {
+		s.mu.Unlock()
+		room.mu.Lock()
+		room.game.Close()
+		room.mu.Unlock()
+		return nil, fmt.Errorf("Room %s already exists", room.Code)
+	}
+	s.rooms[room.Code] = room
+	roomsGauge.Set(float64(len(s.rooms)))
+	s.mu.Unlock()
+	room.HostAway(room.Host().Conn(), s.HostGrace, func() {
+		s.detachRoom(room.Code)
+	})
+	return room, nil
+}
+
+// WatchSnapshots saves snapshots to dir every interval until ctx is done.
+func (s *Server) WatchSnapshots(ctx context.Context, dir string, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.SaveSnapshots(dir); err != nil {
+				slog.Error("Snapshot failed", "err", err)
+			}
+		}
+	}
+}
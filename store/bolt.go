@@ -0,0 +1,137 @@
+package store
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	gamesBucket   = []byte("games")
+	playersBucket = []byte("players")
+)
+
+// BoltStore is a Store kept in a single BoltDB file. Games are stored as
+// JSON by ID, and each player has a bucket of the IDs of their games.
+type BoltStore struct {
+	db *bolt.DB
+}
+
+// OpenBolt opens, or creates, the store at path.
+func OpenBolt(path string) (*BoltStore, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{gamesBucket, playersBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &BoltStore{db: db}, nil
+}
+
+func itob(v uint64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, v)
+	return b
+}
+
+func (s *BoltStore) SaveGame(g *Game) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		games := tx.Bucket(gamesBucket)
+		id, err := games.NextSequence()
+		if err != nil {
+			return err
+		}
+		g.ID = id
+		buf, err := json.Marshal(g)
+		if err != nil {
+			return err
+		}
+		if err := games.Put(itob(id), buf); err != nil {
+			return err
+		}
+		for _, name := range g.Players() {
+			player, err := tx.Bucket(playersBucket).CreateBucketIfNotExists([]byte(name))
+			if err != nil {
+				return err
+			}
+			if err := player.Put(itob(id), nil); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func getGame(tx *bolt.Tx, id []byte) (*Game, error) {
+	buf := tx.Bucket(gamesBucket).Get(id)
+	if buf == nil {
+		return nil, ErrNotFound
+	}
+	var g Game
+	if err := json.Unmarshal(buf, &g); err != nil {
+		return nil, err
+	}
+	return &g, nil
+}
+
+func (s *BoltStore) Game(id uint64) (*Game, error) {
+	var g *Game
+	err := s.db.View(func(tx *bolt.Tx) error {
+		var err error
+		g, err = getGame(tx, itob(id))
+		return err
+	})
+	return g, err
+}
+
+func (s *BoltStore) Games(limit int) ([]*Game, error) {
+	var games []*Game
+	err := s.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(gamesBucket).Cursor()
+		for k, _ := c.Last(); k != nil && len(games) < limit; k, _ = c.Prev() {
+			g, err := getGame(tx, k)
+			if err != nil {
+				return err
+			}
+			games = append(games, g)
+		}
+		return nil
+	})
+	return games, err
+}
+
+func (s *BoltStore) PlayerGames(name string, limit int) ([]*Game, error) {
+	var games []*Game
+	err := s.db.View(func(tx *bolt.Tx) error {
+		player := tx.Bucket(playersBucket).Bucket([]byte(name))
+		if player == nil {
+			return nil
+		}
+		c := player.Cursor()
+		for k, _ := c.Last(); k != nil && len(games) < limit; k, _ = c.Prev() {
+			g, err := getGame(tx, k)
+			if err != nil {
+				return err
+			}
+			games = append(games, g)
+		}
+		return nil
+	})
+	return games, err
+}
+
+func (s *BoltStore) Close() error {
+	return s.db.Close()
+}
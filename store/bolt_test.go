@@ -0,0 +1,70 @@
+package store
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestBoltStore(t *testing.T) {
+	s, err := OpenBolt(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	first := &Game{
+		Room: "ABCD",
+		Rounds: []Round{{
+			Question:   "Longest river?",
+			Multiplier: 1,
+			Answers: []Answer{
+				{Text: "THE NILE", Correct: true, Votes: []string{"bob"}},
+				{Text: "THE AMAZON", Player: "alice"},
+			},
+			Offsets: []Offset{{Player: "bob", Offset: 1500}},
+		}},
+		Totals: []Total{{Player: "bob", Total: 1500}, {Player: "alice"}},
+	}
+	second := &Game{Room: "EFGH", Totals: []Total{{Player: "bob"}}}
+	for _, g := range []*Game{first, second} {
+		if err := s.SaveGame(g); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if first.ID == 0 || second.ID <= first.ID {
+		t.Errorf("Expected increasing IDs, got %d and %d", first.ID, second.ID)
+	}
+
+	g, err := s.Game(first.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g.Room != "ABCD" || g.Rounds[0].Answers[0].Votes[0] != "bob" {
+		t.Errorf("Unexpected game %#v", g)
+	}
+	if _, err := s.Game(100); err != ErrNotFound {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+
+	games, err := s.Games(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(games) != 2 || games[0].ID != second.ID {
+		t.Errorf("Expected the most recent game first, got %d games", len(games))
+	}
+	if games, _ := s.Games(1); len(games) != 1 {
+		t.Errorf("Expected 1 game, got %d", len(games))
+	}
+
+	games, err = s.PlayerGames("alice", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(games) != 1 || games[0].ID != first.ID {
+		t.Errorf("Expected alice to have played the first game only, got %d games", len(games))
+	}
+	if games, _ := s.PlayerGames("nobody", 10); len(games) != 0 {
+		t.Errorf("Expected no games, got %d", len(games))
+	}
+}
@@ -0,0 +1,72 @@
+// Package store keeps a record of finished games so that history and stats
+// outlive the rooms they were played in.
+package store
+
+import (
+	"errors"
+	"time"
+)
+
+var ErrNotFound = errors.New("Game not found")
+
+// Store saves finished games and answers questions about them.
+type Store interface {
+	// SaveGame records g, assigning its ID.
+	SaveGame(g *Game) error
+	// Game returns the game with id.
+	Game(id uint64) (*Game, error)
+	// Games returns up to limit games, most recent first.
+	Games(limit int) ([]*Game, error)
+	// PlayerGames returns up to limit games played by the named player, most
+	// recent first.
+	PlayerGames(name string, limit int) ([]*Game, error)
+	Close() error
+}
+
+// Game is a finished game.
+type Game struct {
+	ID       uint64
+	Room     string
+	Finished time.Time
+	Rounds   []Round
+	Totals   []Total
+}
+
+// Round is a question as it was played.
+type Round struct {
+	Question   string
+	Kind       string `json:",omitempty"`
+	Multiplier int
+	Answers    []Answer
+	Offsets    []Offset
+}
+
+// Answer is the truth or a player's lie, with who voted for it.
+type Answer struct {
+	Text    string
+	Correct bool     `json:",omitempty"`
+	Player  string   `json:",omitempty"`
+	Votes   []string `json:",omitempty"`
+	Likes   []string `json:",omitempty"`
+}
+
+// Offset is the points a player scored in a round.
+type Offset struct {
+	Player string
+	Offset int
+}
+
+// Total is a player's final score.
+type Total struct {
+	Player string
+	Total  int
+}
+
+// Players returns the names of everyone who played g.
+func (g *Game) Players() []string {
+	names := make([]string, 0, len(g.Totals))
+	for _, total := range g.Totals {
+		names = append(names, total.Player)
+	}
+	return names
+}